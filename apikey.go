@@ -0,0 +1,251 @@
+package httprouterext
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownAPIKey is returned by an APIKeyStore for key IDs it does not know.
+var ErrUnknownAPIKey = errors.New("unknown api key")
+
+// apiKeyPrefix marks the secrets generated by GenerateAPIKey.
+const apiKeyPrefix = "hrx_"
+
+// APIKey is a credential of a machine client. Only the hash of the secret is stored.
+type APIKey struct {
+	// ID identifies the key. It is the public part of the secret.
+	ID string
+	// Owner is the principal that permissions are checked for.
+	Owner Principal
+	// Hash is the SHA-256 hash of the secret.
+	Hash []byte
+	// Expires is the time after which the key is rejected. The zero time never expires.
+	Expires time.Time
+	// Scopes limits the permissions that can be granted through the key.
+	// A key without scopes is not limited.
+	Scopes []Permission
+}
+
+// GenerateAPIKey creates a key for owner and returns it together with its secret.
+// The secret is not stored anywhere, it must be shown to the user once and then discarded.
+func GenerateAPIKey(owner Principal, expires time.Time, scopes ...Permission) (APIKey, string, error) {
+	var id [8]byte
+	var random [32]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return APIKey{}, "", fmt.Errorf("generate api key: %w", err)
+	}
+	if _, err := rand.Read(random[:]); err != nil {
+		return APIKey{}, "", fmt.Errorf("generate api key: %w", err)
+	}
+	key := APIKey{
+		ID:      hex.EncodeToString(id[:]),
+		Owner:   owner,
+		Expires: expires,
+		Scopes:  scopes,
+	}
+	secret := apiKeyPrefix + key.ID + "." + base64.RawURLEncoding.EncodeToString(random[:])
+	key.Hash = HashAPIKey(secret)
+	return key, secret, nil
+}
+
+// HashAPIKey returns the hash of a secret as stored in APIKey.Hash.
+func HashAPIKey(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// APIKeyStore looks up API keys by ID.
+type APIKeyStore interface {
+	// APIKey returns the key with the given ID, or ErrUnknownAPIKey.
+	APIKey(ctx context.Context, id string) (APIKey, error)
+}
+
+// MemoryAPIKeyStore is an APIKeyStore that holds its keys in memory.
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]APIKey
+}
+
+// NewMemoryAPIKeyStore creates a store of keys.
+func NewMemoryAPIKeyStore(keys ...APIKey) *MemoryAPIKeyStore {
+	s := &MemoryAPIKeyStore{
+		keys: make(map[string]APIKey, len(keys)),
+	}
+	for _, key := range keys {
+		s.keys[key.ID] = key
+	}
+	return s
+}
+
+// Add adds or replaces key.
+func (s *MemoryAPIKeyStore) Add(key APIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key.ID] = key
+}
+
+// Revoke removes the key with the given ID.
+func (s *MemoryAPIKeyStore) Revoke(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, id)
+}
+
+// APIKey returns the key with the given ID.
+func (s *MemoryAPIKeyStore) APIKey(_ context.Context, id string) (APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, ErrUnknownAPIKey
+	}
+	return key, nil
+}
+
+// APIKeyAuthenticator authenticates requests by an API key in a header or,
+// if configured, a query parameter. The owner of the key is taken as the user ID.
+type APIKeyAuthenticator struct {
+	store  APIKeyStore
+	header string
+	query  string
+	now    func() time.Time
+}
+
+// NewAPIKeyAuthenticator creates an authenticator for the keys of store,
+// sent in the X-API-Key header.
+func NewAPIKeyAuthenticator(store APIKeyStore) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{
+		store:  store,
+		header: "X-API-Key",
+		now:    time.Now,
+	}
+}
+
+// WithHeader sets the header that carries the key.
+func (a *APIKeyAuthenticator) WithHeader(name string) *APIKeyAuthenticator {
+	a.header = name
+	return a
+}
+
+// WithQueryParam also accepts the key in the given query parameter. The
+// parameter is redacted in the logs of WrapWith and left out of the sign-in
+// redirect, but proxies in front of the service may still log it, so the
+// header should be preferred.
+func (a *APIKeyAuthenticator) WithQueryParam(name string) *APIKeyAuthenticator {
+	a.query = name
+	return a
+}
+
+// Authenticate returns the subject that owns the key.
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (Subject, error) {
+	secret := r.Header.Get(a.header)
+	if secret == "" && a.query != "" {
+		secret = r.URL.Query().Get(a.query)
+	}
+	if secret == "" {
+		return Subject{}, ErrNoCredentials
+	}
+
+	id, ok := apiKeyID(secret)
+	if !ok {
+		return Subject{}, invalidCredentials("malformed api key")
+	}
+	key, err := a.store.APIKey(r.Context(), id)
+	if errors.Is(err, ErrUnknownAPIKey) {
+		return Subject{}, invalidCredentials("unknown api key")
+	}
+	if err != nil {
+		return Subject{}, fmt.Errorf("api key %s: %w", id, err)
+	}
+	if subtle.ConstantTimeCompare(HashAPIKey(secret), key.Hash) != 1 {
+		return Subject{}, invalidCredentials("unknown api key")
+	}
+	if !key.Expires.IsZero() && a.now().After(key.Expires) {
+		return Subject{}, invalidCredentials("api key expired")
+	}
+	return Subject{
+		UserId: UserId(key.Owner),
+		Scheme: "apikey",
+		Scopes: key.Scopes,
+	}, nil
+}
+
+// Challenges returns the challenge "APIKey" with the header that carries the
+// key. Like that of ClientCertAuthenticator, it is no registered HTTP scheme,
+// but makes requests without a valid key get a 401 problem with the reason,
+// such as "api key expired", instead of a redirect to the sign-in page.
+func (a *APIKeyAuthenticator) Challenges() []string {
+	return []string{"APIKey header=" + quoteString(a.header)}
+}
+
+// apiKeyID returns the ID part of a secret generated by GenerateAPIKey.
+func apiKeyID(secret string) (string, bool) {
+	rest, ok := strings.CutPrefix(secret, apiKeyPrefix)
+	if !ok {
+		return "", false
+	}
+	id, _, ok := strings.Cut(rest, ".")
+	return id, ok && id != ""
+}
+
+// credentialParams returns the query parameters that carry credentials for auth.
+func credentialParams(auth Authenticator) []string {
+	switch auth := auth.(type) {
+	case *ChainAuthenticator:
+		var params []string
+		for _, a := range auth.authenticators {
+			params = append(params, credentialParams(a)...)
+		}
+		return params
+	case *APIKeyAuthenticator:
+		if auth.query != "" {
+			return []string{auth.query}
+		}
+	}
+	return nil
+}
+
+// redactQuery returns uri with the values of the query parameters params
+// replaced by "REDACTED", or with the parameters removed if remove is true.
+// The other parameters are kept as they are.
+func redactQuery(uri string, params []string, remove bool) string {
+	path, rawQuery, ok := strings.Cut(uri, "?")
+	if !ok || len(params) == 0 {
+		return uri
+	}
+	var parts []string
+	for _, part := range strings.Split(rawQuery, "&") {
+		key, _, _ := strings.Cut(part, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		switch {
+		case !slices.Contains(params, name):
+			parts = append(parts, part)
+		case !remove:
+			parts = append(parts, key+"=REDACTED")
+		}
+	}
+	if len(parts) == 0 {
+		return path
+	}
+	return path + "?" + strings.Join(parts, "&")
+}
+
+// inScope reports whether permission may be granted to a subject with scopes.
+func inScope(scopes []Permission, permission Permission) bool {
+	return len(scopes) == 0 || slices.Contains(scopes, permission)
+}
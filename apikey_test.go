@@ -0,0 +1,137 @@
+package httprouterext
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	valid, validSecret, err := GenerateAPIKey("svc", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, expiredSecret, err := GenerateAPIKey("svc", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, unknownSecret, err := GenerateAPIKey("svc", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewAPIKeyAuthenticator(NewMemoryAPIKeyStore(valid, expired)).WithQueryParam("api_key")
+
+	tests := []struct {
+		name       string
+		header     string
+		query      string
+		wantReason string
+	}{
+		{name: "header", header: validSecret},
+		{name: "query", query: validSecret},
+		{name: "expired", header: expiredSecret, wantReason: "api key expired"},
+		{name: "unknown", header: unknownSecret, wantReason: "unknown api key"},
+		{name: "wrong secret", header: validSecret + "x", wantReason: "unknown api key"},
+		{name: "malformed", header: "secret", wantReason: "malformed api key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/?api_key="+tt.query, nil)
+			if tt.header != "" {
+				r.Header.Set("X-API-Key", tt.header)
+			}
+			subject, err := auth.Authenticate(r)
+			if tt.wantReason == "" {
+				if err != nil || subject.UserId != "svc" {
+					t.Errorf("Authenticate() = %+v, %v, want svc", subject, err)
+				}
+				return
+			}
+			credentialsErr, ok := err.(*CredentialsError)
+			if !ok || credentialsErr.Reason != tt.wantReason {
+				t.Errorf("Authenticate() error = %v, want %q", err, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestAPIKeyQueryParamIsNotLogged(t *testing.T) {
+	expired, secret, err := GenerateAPIKey("svc", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewAPIKeyAuthenticator(NewMemoryAPIKeyStore(expired)).WithQueryParam("api_key")
+
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+	hdl := WrapWith(&testWrapper{}, extractResource(&testResource{}), okHandler, WithAuthenticator(auth))
+
+	for _, accept := range []string{"text/html", "application/json"} {
+		r := httptest.NewRequest(http.MethodGet, "/articles?page=2&api_key="+secret, nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		hdl(w, r, nil)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401", w.Code)
+		}
+		if location := w.Header().Get("Location"); strings.Contains(location, secret) || strings.Contains(location, "api_key") {
+			t.Errorf("Location = %s contains the api key", location)
+		}
+	}
+	if strings.Contains(logs.String(), secret) {
+		t.Errorf("logs contain the api key:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "/articles?page=2&api_key=REDACTED") {
+		t.Errorf("logs lack the redacted URI:\n%s", logs.String())
+	}
+}
+
+func TestAPIKeyChallenge(t *testing.T) {
+	expired, secret, err := GenerateAPIKey("svc", time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewAPIKeyAuthenticator(NewMemoryAPIKeyStore(expired))
+	hdl := WrapWith(&testWrapper{}, extractResource(&testResource{}), okHandler, WithAuthenticator(auth))
+
+	tests := []struct {
+		name       string
+		secret     string
+		wantDetail string
+	}{
+		{name: "no key", wantDetail: "authentication required"},
+		{name: "expired key", secret: secret, wantDetail: "api key expired"},
+		{name: "malformed key", secret: "secret", wantDetail: "malformed api key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A machine client on a plain GET, which would be redirected without a challenge.
+			r := httptest.NewRequest(http.MethodGet, "/articles", nil)
+			r.Header.Set("Accept", "*/*")
+			if tt.secret != "" {
+				r.Header.Set("X-API-Key", tt.secret)
+			}
+			w := httptest.NewRecorder()
+			hdl(w, r, nil)
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want 401", w.Code)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != `APIKey header="X-API-Key"` {
+				t.Errorf("WWW-Authenticate = %q", got)
+			}
+			var doc problemDocument
+			if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+				t.Fatal(err)
+			}
+			if doc.Detail != tt.wantDetail {
+				t.Errorf("detail = %q, want %q", doc.Detail, tt.wantDetail)
+			}
+		})
+	}
+}
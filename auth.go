@@ -0,0 +1,352 @@
+package httprouterext
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrNoCredentials is returned by an Authenticator when a request carries
+	// no credentials it understands.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned by an Authenticator when a request carries
+	// credentials that are malformed, unknown or wrong.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// CredentialsError is an error wrapping ErrInvalidCredentials with a reason
+// that is safe to tell the client, such as "token expired".
+type CredentialsError struct {
+	Reason string
+}
+
+func (e *CredentialsError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrInvalidCredentials, e.Reason)
+}
+
+// Unwrap returns ErrInvalidCredentials.
+func (e *CredentialsError) Unwrap() error {
+	return ErrInvalidCredentials
+}
+
+// invalidCredentials returns a CredentialsError with the given reason.
+func invalidCredentials(reason string) error {
+	return &CredentialsError{Reason: reason}
+}
+
+// unauthorizedProblem returns the 401 problem for an error wrapping ErrNoCredentials
+// or ErrInvalidCredentials. The reason of a CredentialsError becomes the detail.
+func unauthorizedProblem(err error) *Problem {
+	if errors.Is(err, ErrNoCredentials) {
+		return NewProblem(http.StatusUnauthorized, "authentication required")
+	}
+	detail := "invalid credentials"
+	var credentialsErr *CredentialsError
+	if errors.As(err, &credentialsErr) {
+		detail = credentialsErr.Reason
+	}
+	return NewProblem(http.StatusUnauthorized, detail).WithCause(err)
+}
+
+// Subject is the authenticated originator of a request.
+type Subject struct {
+	// UserId is the identity that permissions are checked for.
+	UserId UserId
+	// Token is the credential the subject presented, if it is a token
+	// such as a session cookie or a bearer token.
+	Token string
+	// Scheme names how the subject was authenticated, e.g. "session" or "basic".
+	Scheme string
+	// Scopes limits the permissions that can be granted to the subject,
+	// such as the scopes of an API key. A subject without scopes is not limited.
+	Scopes []Permission
+}
+
+// Authenticator determines the Subject of a request.
+//
+// Authenticate returns an error wrapping ErrNoCredentials if the request carries
+// no credentials for the authenticator, and an error wrapping ErrInvalidCredentials
+// if it carries credentials that are not valid. Any other error is a failure of
+// the authenticator itself.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Subject, error)
+}
+
+// AuthenticatorFunc is an adapter to use an ordinary function as an Authenticator.
+type AuthenticatorFunc func(r *http.Request) (Subject, error)
+
+// Authenticate calls f(r).
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (Subject, error) {
+	return f(r)
+}
+
+// Challenger is implemented by authenticators that tell a client how to
+// authenticate. Challenges returns the values of the WWW-Authenticate headers
+// sent with a 401 response.
+type Challenger interface {
+	Challenges() []string
+}
+
+// challengesOf returns the WWW-Authenticate challenges of auth, if any.
+func challengesOf(auth Authenticator) []string {
+	if c, ok := auth.(Challenger); ok {
+		return c.Challenges()
+	}
+	return nil
+}
+
+// ChainAuthenticator tries several authenticators in order.
+type ChainAuthenticator struct {
+	authenticators []Authenticator
+}
+
+// Chain creates an authenticator that tries auths in order.
+// The first authenticator that finds credentials in the request decides:
+// its subject or its error is returned. If none finds credentials,
+// ErrNoCredentials is returned.
+func Chain(auths ...Authenticator) *ChainAuthenticator {
+	return &ChainAuthenticator{
+		authenticators: auths,
+	}
+}
+
+// Authenticate authenticates r with the first authenticator that finds credentials.
+func (c *ChainAuthenticator) Authenticate(r *http.Request) (Subject, error) {
+	for _, auth := range c.authenticators {
+		subject, err := auth.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return subject, err
+	}
+	return Subject{}, ErrNoCredentials
+}
+
+// Challenges returns the challenges of all authenticators in the chain.
+func (c *ChainAuthenticator) Challenges() []string {
+	var challenges []string
+	for _, auth := range c.authenticators {
+		challenges = append(challenges, challengesOf(auth)...)
+	}
+	return challenges
+}
+
+// CookieAuthenticator authenticates requests by the value of a cookie,
+// which is taken as the user ID.
+type CookieAuthenticator struct {
+	name string
+}
+
+// NewCookieAuthenticator creates an authenticator for the cookie with the given name.
+func NewCookieAuthenticator(name string) *CookieAuthenticator {
+	return &CookieAuthenticator{
+		name: name,
+	}
+}
+
+// Authenticate returns the subject identified by the cookie.
+func (a *CookieAuthenticator) Authenticate(r *http.Request) (Subject, error) {
+	cookie, err := r.Cookie(a.name)
+	if err != nil {
+		return Subject{}, ErrNoCredentials
+	}
+	if cookie.Value == "" {
+		return Subject{}, fmt.Errorf("empty cookie %s: %w", a.name, ErrInvalidCredentials)
+	}
+	return Subject{
+		UserId: UserId(cookie.Value),
+		Token:  cookie.Value,
+		Scheme: "session",
+	}, nil
+}
+
+// BearerAuthenticator authenticates requests by the token of an
+// "Authorization: Bearer" header, which is taken as the user ID.
+type BearerAuthenticator struct{}
+
+// NewBearerAuthenticator creates a bearer token authenticator.
+func NewBearerAuthenticator() *BearerAuthenticator {
+	return &BearerAuthenticator{}
+}
+
+// Authenticate returns the subject identified by the bearer token.
+func (a *BearerAuthenticator) Authenticate(r *http.Request) (Subject, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return Subject{}, err
+	}
+	return Subject{
+		UserId: UserId(token),
+		Token:  token,
+		Scheme: "bearer",
+	}, nil
+}
+
+// Challenges returns the Bearer challenge.
+func (a *BearerAuthenticator) Challenges() []string {
+	return []string{"Bearer"}
+}
+
+// bearerToken returns the token of the Authorization header of r.
+func bearerToken(r *http.Request) (string, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", ErrNoCredentials
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("empty bearer token: %w", ErrInvalidCredentials)
+	}
+	return token, nil
+}
+
+// HeaderAuthenticator authenticates requests by the value of a custom header,
+// which is taken as the user ID.
+type HeaderAuthenticator struct {
+	name string
+}
+
+// NewHeaderAuthenticator creates an authenticator for the header with the given name.
+func NewHeaderAuthenticator(name string) *HeaderAuthenticator {
+	return &HeaderAuthenticator{
+		name: name,
+	}
+}
+
+// Authenticate returns the subject identified by the header.
+func (a *HeaderAuthenticator) Authenticate(r *http.Request) (Subject, error) {
+	value := r.Header.Get(a.name)
+	if value == "" {
+		return Subject{}, ErrNoCredentials
+	}
+	return Subject{
+		UserId: UserId(value),
+		Scheme: "header",
+	}, nil
+}
+
+// BasicAuthenticator authenticates requests with HTTP basic authentication.
+// The username is taken as the user ID.
+type BasicAuthenticator struct {
+	wrapper   BasicWrapper
+	realm     string
+	utf8      bool
+	redaction usernameRedaction
+	clientIP  func(r *http.Request) string
+}
+
+// NewBasicAuthenticator creates a basic authenticator that verifies
+// username and password with wrapper.
+func NewBasicAuthenticator(wrapper BasicWrapper) *BasicAuthenticator {
+	return &BasicAuthenticator{
+		wrapper:  wrapper,
+		realm:    "restricted",
+		clientIP: clientIP,
+	}
+}
+
+// WithRealm sets the realm of the challenge. The default is "restricted".
+func (a *BasicAuthenticator) WithRealm(realm string) *BasicAuthenticator {
+	a.realm = realm
+	return a
+}
+
+// WithCharsetUTF8 adds charset="UTF-8" to the challenge (RFC 7617) to tell
+// clients to encode username and password in UTF-8.
+func (a *BasicAuthenticator) WithCharsetUTF8() *BasicAuthenticator {
+	a.utf8 = true
+	return a
+}
+
+// WithRedactedUsernames replaces the usernames of failed authentications in
+// errors, and thus in logs, by their HMAC-SHA256 under key. The MAC still allows
+// to correlate attempts for the same username, but cannot be reversed without
+// the key. With an empty key, usernames are left out entirely.
+func (a *BasicAuthenticator) WithRedactedUsernames(key []byte) *BasicAuthenticator {
+	a.redaction = usernameRedaction{enabled: true, key: key}
+	return a
+}
+
+// WithClientIPFunc sets how the IP address of the client that is passed to the
+// BasicWrapper is determined, see ProxyClientIP. The default is the address of
+// the peer of the request. A client IP that the context of the request already
+// carries, see WithClientIP, takes precedence.
+func (a *BasicAuthenticator) WithClientIPFunc(f func(r *http.Request) string) *BasicAuthenticator {
+	a.clientIP = f
+	return a
+}
+
+// Authenticate returns the subject identified by the username.
+func (a *BasicAuthenticator) Authenticate(r *http.Request) (Subject, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return Subject{}, ErrNoCredentials
+	}
+	ctx := r.Context()
+	if _, ok := ClientIPFromContext(ctx); !ok {
+		ctx = WithClientIP(ctx, a.clientIP(r))
+	}
+	ok, err := a.wrapper.Authenticate(ctx, []byte(username), []byte(password))
+	if err != nil {
+		return Subject{}, fmt.Errorf("authenticate basic: %w", err)
+	}
+	if !ok {
+		return Subject{}, fmt.Errorf("user %s: %w", a.loggedUsername(username), ErrInvalidCredentials)
+	}
+	return Subject{
+		UserId: UserId(username),
+		Scheme: "basic",
+	}, nil
+}
+
+// loggedUsername returns username as it may appear in logs.
+func (a *BasicAuthenticator) loggedUsername(username string) string {
+	return a.redaction.logged(username)
+}
+
+// usernameRedaction replaces usernames in logs, see WithRedactedUsernames.
+type usernameRedaction struct {
+	enabled bool
+	key     []byte
+}
+
+// logged returns username as it may appear in logs.
+func (r usernameRedaction) logged(username string) string {
+	if !r.enabled {
+		return username
+	}
+	if len(r.key) == 0 {
+		return "[redacted]"
+	}
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(username))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// Challenges returns the Basic challenge.
+func (a *BasicAuthenticator) Challenges() []string {
+	challenge := "Basic realm=" + quoteString(a.realm)
+	if a.utf8 {
+		challenge += `, charset="UTF-8"`
+	}
+	return []string{challenge}
+}
+
+// quoteString returns s as an HTTP quoted-string.
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range s {
+		if c == '"' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package httprouterext
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBasicAuthenticatorRedactsUsernames(t *testing.T) {
+	tests := []struct {
+		name   string
+		auth   *BasicAuthenticator
+		want   string
+		reveal bool
+	}{
+		{name: "plain", auth: NewBasicAuthenticator(testBasicWrapper{}), want: "user alice:", reveal: true},
+		{name: "keyed", auth: NewBasicAuthenticator(testBasicWrapper{}).WithRedactedUsernames([]byte("key")), want: "user hmac:"},
+		{name: "without key", auth: NewBasicAuthenticator(testBasicWrapper{}).WithRedactedUsernames(nil), want: "user [redacted]:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.SetBasicAuth("alice", "wrong")
+			_, err := tt.auth.Authenticate(r)
+			if err == nil {
+				t.Fatal("Authenticate() succeeded with a wrong password")
+			}
+			if !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("error = %q, want prefix %q", err, tt.want)
+			}
+			if strings.Contains(err.Error(), "alice") != tt.reveal {
+				t.Errorf("error = %q reveals the username: %v, want %v", err, !tt.reveal, tt.reveal)
+			}
+		})
+	}
+
+	// The MAC depends on the key, so it cannot be looked up in a dictionary of hashes.
+	a := NewBasicAuthenticator(testBasicWrapper{}).WithRedactedUsernames([]byte("a"))
+	b := NewBasicAuthenticator(testBasicWrapper{}).WithRedactedUsernames([]byte("b"))
+	if a.loggedUsername("alice") == b.loggedUsername("alice") {
+		t.Error("redacted usernames do not depend on the key")
+	}
+}
@@ -0,0 +1,142 @@
+package httprouterext
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimestampCookie issues and verifies the check_ts cookie that carries a
+// check-service timestamp from a write to the checks of subsequent requests,
+// so that users see the effect of their own changes.
+//
+// The cookie is signed with HMAC-SHA256 and bound to the token of the session
+// it was issued for. It carries its issue time and expires after a maximum age.
+// Cookies that fail verification are ignored and cleared.
+type TimestampCookie struct {
+	name   string
+	keys   [][]byte
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+// NewTimestampCookie creates a check_ts cookie that is valid for maxAge.
+// The first key signs new cookies, all keys verify cookies. To rotate keys,
+// prepend a new key and drop the last one once maxAge has passed.
+func NewTimestampCookie(maxAge time.Duration, keys ...[]byte) *TimestampCookie {
+	if len(keys) == 0 {
+		panic("NewTimestampCookie requires at least one key")
+	}
+	return &TimestampCookie{
+		name:   "check_ts",
+		keys:   keys,
+		maxAge: maxAge,
+		now:    time.Now,
+	}
+}
+
+// Set sets a cookie for ts on w, bound to token. Handlers call it with the
+// timestamp of a write and the Token of the User. Set does nothing if token is
+// empty, as for basic authentication, because the cookie could not be bound to
+// a session.
+func (c *TimestampCookie) Set(w http.ResponseWriter, token string, ts Timestamp) {
+	if token == "" {
+		return
+	}
+	issued := strconv.FormatInt(c.now().Unix(), 10)
+	encodedTs := base64.RawURLEncoding.EncodeToString([]byte(ts))
+	mac := c.sign(c.keys[0], token, encodedTs, issued)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.name,
+		Value:    fmt.Sprintf("%s.%s.%s", encodedTs, issued, base64.RawURLEncoding.EncodeToString(mac)),
+		Path:     "/",
+		MaxAge:   int(c.maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Clear removes the cookie.
+func (c *TimestampCookie) Clear(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// timestamp returns the timestamp of the cookie of r if it is present and valid
+// for token. An invalid cookie is cleared on w.
+func (c *TimestampCookie) timestamp(w http.ResponseWriter, r *http.Request, token string) (Timestamp, bool) {
+	cookie, err := r.Cookie(c.name)
+	if err != nil {
+		return "", false
+	}
+	ts, err := c.verify(cookie.Value, token)
+	if err != nil {
+		c.Clear(w)
+		return "", false
+	}
+	return ts, true
+}
+
+// verify checks the signature and age of value and returns its timestamp.
+func (c *TimestampCookie) verify(value string, token string) (Timestamp, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed %s cookie", c.name)
+	}
+	encodedTs, issued, encodedMac := parts[0], parts[1], parts[2]
+
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMac)
+	if err != nil {
+		return "", fmt.Errorf("decode %s signature: %w", c.name, err)
+	}
+	valid := false
+	for _, key := range c.keys {
+		if hmac.Equal(mac, c.sign(key, token, encodedTs, issued)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return "", fmt.Errorf("invalid %s signature", c.name)
+	}
+
+	issuedUnix, err := strconv.ParseInt(issued, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("parse %s issue time: %w", c.name, err)
+	}
+	if age := c.now().Sub(time.Unix(issuedUnix, 0)); age > c.maxAge || age < -time.Minute {
+		return "", fmt.Errorf("expired %s cookie", c.name)
+	}
+
+	ts, err := base64.RawURLEncoding.DecodeString(encodedTs)
+	if err != nil || len(ts) == 0 {
+		return "", fmt.Errorf("decode %s timestamp", c.name)
+	}
+	return Timestamp(ts), nil
+}
+
+// sign returns the MAC of a cookie. The cookie name and token are included so that
+// a cookie is only valid for the session it was issued to.
+func (c *TimestampCookie) sign(key []byte, token, encodedTs, issued string) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, s := range []string{c.name, token, encodedTs, issued} {
+		h.Write([]byte(strconv.Itoa(len(s))))
+		h.Write([]byte{':'})
+		h.Write([]byte(s))
+	}
+	return h.Sum(nil)
+}
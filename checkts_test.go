@@ -0,0 +1,136 @@
+package httprouterext
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// issueTimestampCookie returns the value of a cookie c sets for token and ts.
+func issueTimestampCookie(t *testing.T, c *TimestampCookie, token string, ts Timestamp) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c.Set(w, token, ts)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+	return cookies[0].Value
+}
+
+func TestTimestampCookieVerify(t *testing.T) {
+	oldKey, newKey := []byte("old key"), []byte("new key")
+	issuedAt := time.Unix(1_700_000_000, 0)
+	issuer := NewTimestampCookie(time.Minute, oldKey)
+	issuer.now = func() time.Time { return issuedAt }
+	value := issueTimestampCookie(t, issuer, "token", "ts-1")
+
+	tests := []struct {
+		name    string
+		keys    [][]byte
+		value   string
+		token   string
+		age     time.Duration
+		wantErr bool
+	}{
+		{name: "valid", keys: [][]byte{oldKey}, value: value, token: "token"},
+		{name: "rotated key", keys: [][]byte{newKey, oldKey}, value: value, token: "token"},
+		{name: "dropped key", keys: [][]byte{newKey}, value: value, token: "token", wantErr: true},
+		{name: "other token", keys: [][]byte{oldKey}, value: value, token: "other", wantErr: true},
+		{name: "empty token", keys: [][]byte{oldKey}, value: value, token: "", wantErr: true},
+		{name: "max age", keys: [][]byte{oldKey}, value: value, token: "token", age: time.Minute},
+		{name: "expired", keys: [][]byte{oldKey}, value: value, token: "token", age: time.Minute + time.Second, wantErr: true},
+		{name: "issued in the future", keys: [][]byte{oldKey}, value: value, token: "token", age: -2 * time.Minute, wantErr: true},
+		{name: "tampered timestamp", keys: [][]byte{oldKey}, value: "dHMtMg" + value[len("dHMtMQ"):], token: "token", wantErr: true},
+		{name: "malformed", keys: [][]byte{oldKey}, value: "ts", token: "token", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewTimestampCookie(time.Minute, tt.keys...)
+			c.now = func() time.Time { return issuedAt.Add(tt.age) }
+			ts, err := c.verify(tt.value, tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("verify() = %q, want error", ts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify() error = %v", err)
+			}
+			if ts != "ts-1" {
+				t.Errorf("verify() = %q, want %q", ts, "ts-1")
+			}
+		})
+	}
+}
+
+func TestTimestampCookieClearsInvalid(t *testing.T) {
+	c := NewTimestampCookie(time.Minute, []byte("key"))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "check_ts", Value: "forged"})
+	w := httptest.NewRecorder()
+	if _, ok := c.timestamp(w, r, "token"); ok {
+		t.Fatal("timestamp() accepted a forged cookie")
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("cookies = %v, want the cookie cleared", cookies)
+	}
+}
+
+func TestTimestampCookieSetWithoutToken(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewTimestampCookie(time.Minute, []byte("key")).Set(w, "", "ts")
+	if cookies := w.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("Set() without token set %v", cookies)
+	}
+}
+
+func TestWrapTimestampCookie(t *testing.T) {
+	c := NewTimestampCookie(time.Minute, []byte("key"))
+	resource := &testResource{ns: "article", obj: "1", permission: "article.get"}
+
+	tests := []struct {
+		name    string
+		auth    Authenticator
+		header  string
+		value   string
+		boundTo string
+		want    Timestamp
+	}{
+		{name: "session", auth: NewBearerAuthenticator(), header: "Authorization", value: "Bearer token", boundTo: "token", want: "ts"},
+		{name: "other session", auth: NewBearerAuthenticator(), header: "Authorization", value: "Bearer other", boundTo: "token", want: ""},
+		// A cookie bound to the empty token must not apply to subjects without a token.
+		{name: "no token", auth: NewHeaderAuthenticator("X-User"), header: "X-User", value: "alice", boundTo: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapper := &testWrapper{granted: map[Permission]bool{"article.get": true}}
+			hdl := WrapWith(wrapper, extractResource(resource), okHandler, WithAuthenticator(tt.auth), WithTimestampCookie(c))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(tt.header, tt.value)
+			r.AddCookie(&http.Cookie{Name: "check_ts", Value: signedTimestampCookie(c, tt.boundTo, "ts")})
+			w := httptest.NewRecorder()
+			hdl(w, r, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if len(wrapper.timestamps) != 1 || wrapper.timestamps[0] != tt.want {
+				t.Errorf("checked at %q, want %q", wrapper.timestamps, tt.want)
+			}
+		})
+	}
+}
+
+// signedTimestampCookie returns a valid cookie value for token and ts, also
+// for an empty token, for which Set issues no cookie.
+func signedTimestampCookie(c *TimestampCookie, token string, ts Timestamp) string {
+	issued := strconv.FormatInt(c.now().Unix(), 10)
+	encodedTs := base64.RawURLEncoding.EncodeToString([]byte(ts))
+	mac := c.sign(c.keys[0], token, encodedTs, issued)
+	return encodedTs + "." + issued + "." + base64.RawURLEncoding.EncodeToString(mac)
+}
@@ -51,6 +51,12 @@ func (s Permission) String() string {
 const RelUnspecified = Permission("...")
 const RelParent = Permission("parent")
 
+// NsToken is the namespace of session tokens.
+const NsToken = Namespace("token")
+
+// RelIs relates a token to the principal it was issued to.
+const RelIs = Permission("is")
+
 // UserId is a user's ID.
 type UserId string
 
@@ -126,7 +132,7 @@ func (c *Client) WithObserveList(f func(ns Namespace, permission Permission, use
 // It returns a list of object IDs.
 func (c *Client) List(ctx context.Context, ns Namespace, permission Permission, userId UserId) ([]string, error) {
 	begin := time.Now().UnixMilli()
-	list, err := c.grpcClient.List(ctx, &proto.ListRequest{
+	list, err := c.grpcClient.List(outgoingContext(ctx), &proto.ListRequest{
 		Ns:     string(ns),
 		Rel:    string(permission),
 		UserId: string(userId),
@@ -156,7 +162,7 @@ func (c *Client) CheckWithTimestamp(ctx context.Context, ns Namespace, obj Obj,
 	}
 	begin := time.Now().UnixMilli()
 
-	res, err := c.grpcClient.Check(ctx, &proto.CheckRequest{
+	res, err := c.grpcClient.Check(outgoingContext(ctx), &proto.CheckRequest{
 		Ns:     string(ns),
 		Obj:    string(obj),
 		Rel:    string(permission),
@@ -189,6 +195,30 @@ func (c *Client) CheckWithTimestamp(ctx context.Context, ns Namespace, obj Obj,
 	}
 }
 
+// ResolveToken returns the principal a token was issued to, that is the user of
+// the tuple token:<token>#is. It returns ErrUnknownToken if there is no such tuple.
+func (c *Client) ResolveToken(ctx context.Context, token string) (Principal, error) {
+	rel := string(RelIs)
+	res, err := c.grpcClient.Read(outgoingContext(ctx), &proto.ReadRequest{
+		TupleSets: []*proto.TupleSet{{
+			Ns: string(NsToken),
+			Spec: &proto.TupleSet_ObjectSpec_{ObjectSpec: &proto.TupleSet_ObjectSpec{
+				Obj: token,
+				Rel: &rel,
+			}},
+		}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("resolve token: %w", err)
+	}
+	for _, tuple := range res.Tuples {
+		if userId := tuple.GetUserId(); userId != "" {
+			return Principal(userId), nil
+		}
+	}
+	return "", ErrUnknownToken
+}
+
 // NaiveBasicClient is a basic auth authenticator that holds a single
 // username and password.
 type NaiveBasicClient struct {
@@ -227,7 +257,7 @@ func (c *Client) AddOneUserId(ctx context.Context, ns Namespace, obj Obj, rel Pe
 		User: &proto.Tuple_UserId{UserId: string(userId)},
 	}
 
-	_, err := c.grpcClient.Write(ctx, &proto.WriteRequest{
+	_, err := c.grpcClient.Write(outgoingContext(ctx), &proto.WriteRequest{
 		AddTuples: []*proto.Tuple{&addTuple},
 	})
 	if err != nil {
@@ -246,6 +276,30 @@ func (c *Client) AddParent(ctx context.Context, ns Namespace, obj Obj, parentNs
 	return c.AddOneUserSet(ctx, ns, obj, RelParent, userSet)
 }
 
+// HasParent reports whether parentNs:parentObj is the parent of ns:obj, that is
+// whether the tuple written by AddParent exists.
+func (c *Client) HasParent(ctx context.Context, ns Namespace, obj Obj, parentNs Namespace, parentObj Obj) (bool, error) {
+	rel := string(RelParent)
+	res, err := c.grpcClient.Read(outgoingContext(ctx), &proto.ReadRequest{
+		TupleSets: []*proto.TupleSet{{
+			Ns: string(ns),
+			Spec: &proto.TupleSet_ObjectSpec_{ObjectSpec: &proto.TupleSet_ObjectSpec{
+				Obj: string(obj),
+				Rel: &rel,
+			}},
+		}},
+	})
+	if err != nil {
+		return false, fmt.Errorf("hasParent %s,%s,%s,%s: %w", ns, obj, parentNs, parentObj, err)
+	}
+	for _, tuple := range res.Tuples {
+		if userSet := tuple.GetUserSet(); userSet != nil && userSet.GetNs() == string(parentNs) && userSet.GetObj() == string(parentObj) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (c *Client) AddOneUserSet(ctx context.Context, ns Namespace, obj Obj, rel Permission, userSet UserSet) error {
 	addTuple := proto.Tuple{
 		Ns:  string(ns),
@@ -258,7 +312,7 @@ func (c *Client) AddOneUserSet(ctx context.Context, ns Namespace, obj Obj, rel P
 		}},
 	}
 
-	_, err := c.grpcClient.Write(ctx, &proto.WriteRequest{
+	_, err := c.grpcClient.Write(outgoingContext(ctx), &proto.WriteRequest{
 		AddTuples: []*proto.Tuple{&addTuple},
 	})
 	if err != nil {
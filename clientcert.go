@@ -0,0 +1,108 @@
+package httprouterext
+
+import (
+	"crypto/x509"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CertRule maps a verified client certificate to a user ID.
+// It returns false if the rule does not apply to the certificate.
+type CertRule func(cert *x509.Certificate) (UserId, bool)
+
+// CommonNameRule maps the subject common name of a certificate to a user ID.
+// The user ID is the common name with prefix prepended, e.g. "svc:".
+func CommonNameRule(prefix string) CertRule {
+	return func(cert *x509.Certificate) (UserId, bool) {
+		if cert.Subject.CommonName == "" {
+			return "", false
+		}
+		return UserId(prefix + cert.Subject.CommonName), true
+	}
+}
+
+// SPIFFERule maps a SPIFFE ID (spiffe://<trustDomain>/<path>) in the URI SANs
+// of a certificate to a user ID. The user ID is the full SPIFFE ID.
+func SPIFFERule(trustDomain string) CertRule {
+	return func(cert *x509.Certificate) (UserId, bool) {
+		for _, uri := range cert.URIs {
+			if uri.Scheme == "spiffe" && strings.EqualFold(uri.Host, trustDomain) && uri.Path != "" && uri.Path != "/" {
+				return UserId(uri.String()), true
+			}
+		}
+		return "", false
+	}
+}
+
+// EmailRule maps an email address SAN of a certificate in domain to a user ID.
+// If domain is empty, any address is accepted.
+func EmailRule(domain string) CertRule {
+	return func(cert *x509.Certificate) (UserId, bool) {
+		for _, email := range cert.EmailAddresses {
+			_, host, ok := strings.Cut(email, "@")
+			if ok && (domain == "" || strings.EqualFold(host, domain)) {
+				return UserId(email), true
+			}
+		}
+		return "", false
+	}
+}
+
+// ClientCertAuthenticator authenticates requests by the client certificate of
+// a TLS connection that is terminated by the Go server. The server must be
+// configured to verify client certificates, e.g. with tls.VerifyClientCertIfGiven
+// and the ClientCAs of the internal CA, because only the verified chains of
+// the connection are considered.
+//
+// The rules are tried in order, and the first rule that applies to the leaf
+// certificate determines the user ID.
+type ClientCertAuthenticator struct {
+	rules []CertRule
+	now   func() time.Time
+}
+
+// NewClientCertAuthenticator creates an authenticator that maps certificates with rules.
+func NewClientCertAuthenticator(rules ...CertRule) *ClientCertAuthenticator {
+	return &ClientCertAuthenticator{
+		rules: rules,
+		now:   time.Now,
+	}
+}
+
+// Authenticate returns the subject identified by the client certificate.
+func (a *ClientCertAuthenticator) Authenticate(r *http.Request) (Subject, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return Subject{}, ErrNoCredentials
+	}
+	if len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return Subject{}, invalidCredentials("client certificate not verified")
+	}
+	// The chains are verified during the handshake, but connections can
+	// outlive the certificates.
+	now := a.now()
+	for _, cert := range r.TLS.VerifiedChains[0] {
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return Subject{}, invalidCredentials("client certificate expired")
+		}
+	}
+
+	leaf := r.TLS.VerifiedChains[0][0]
+	for _, rule := range a.rules {
+		if userId, ok := rule(leaf); ok {
+			return Subject{
+				UserId: userId,
+				Scheme: "mtls",
+			}, nil
+		}
+	}
+	return Subject{}, invalidCredentials("client certificate not mapped to a user")
+}
+
+// Challenges returns the challenge "ClientCertificate". HTTP defines no
+// authentication scheme for client certificates, but the challenge makes
+// requests without a valid certificate get a 401 problem instead of a redirect
+// to the sign-in page.
+func (a *ClientCertAuthenticator) Challenges() []string {
+	return []string{"ClientCertificate"}
+}
@@ -0,0 +1,109 @@
+package httprouterext
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ecociel/httprouterext/mtlstest"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestClientCertAuthenticator(t *testing.T) {
+	ca, err := mtlstest.NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCA, err := mtlstest.NewCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig, err := ca.ServerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := NewClientCertAuthenticator(SPIFFERule("example.org"), EmailRule("example.org"), CommonNameRule("svc:"))
+	wrapper := &testWrapper{granted: map[Permission]bool{"article.get": true}}
+	hdl := WrapWith(wrapper, extractResource(&testResource{ns: "article", obj: "1", permission: "article.get"}),
+		func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params, _ Resource, u User) error {
+			_, err := io.WriteString(w, string(u.Subject()))
+			return err
+		}, WithAuthenticator(auth))
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hdl(w, r, nil)
+	}))
+	server.TLS = serverConfig
+	server.StartTLS()
+	defer server.Close()
+
+	const spiffeID = "spiffe://example.org/ns/default/sa/billing"
+	// clientConfig returns the configuration of a client with a certificate
+	// for id issued by issuer, or without certificate if id is nil.
+	clientConfig := func(issuer *mtlstest.CA, id *mtlstest.Identity) *tls.Config {
+		t.Helper()
+		if id == nil {
+			return &tls.Config{RootCAs: ca.Pool()}
+		}
+		config, err := issuer.ClientConfig(*id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The server certificate is issued by ca.
+		config.RootCAs = ca.Pool()
+		return config
+	}
+
+	tests := []struct {
+		name          string
+		config        *tls.Config
+		now           time.Time
+		wantStatus    int
+		wantSubject   string
+		wantHandshake bool
+	}{
+		{name: "SPIFFE ID", config: clientConfig(ca, &mtlstest.Identity{CommonName: "billing", SPIFFEID: spiffeID}), wantStatus: http.StatusOK, wantSubject: spiffeID},
+		{name: "email", config: clientConfig(ca, &mtlstest.Identity{Emails: []string{"ops@example.org"}}), wantStatus: http.StatusOK, wantSubject: "ops@example.org"},
+		{name: "common name", config: clientConfig(ca, &mtlstest.Identity{CommonName: "billing"}), wantStatus: http.StatusOK, wantSubject: "svc:billing"},
+		{name: "no rule applies", config: clientConfig(ca, &mtlstest.Identity{Emails: []string{"ops@example.com"}}), wantStatus: http.StatusUnauthorized},
+		{name: "expired during the connection", config: clientConfig(ca, &mtlstest.Identity{CommonName: "billing"}), now: time.Now().Add(24 * 365 * time.Hour), wantStatus: http.StatusUnauthorized},
+		{name: "no certificate", config: clientConfig(ca, nil), wantStatus: http.StatusUnauthorized},
+		{name: "untrusted CA", config: clientConfig(otherCA, &mtlstest.Identity{CommonName: "billing"}), wantHandshake: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth.now = time.Now
+			if !tt.now.IsZero() {
+				auth.now = func() time.Time { return tt.now }
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: tt.config}}
+			defer client.CloseIdleConnections()
+
+			resp, err := client.Get(server.URL)
+			if tt.wantHandshake {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatal("the handshake with an untrusted certificate succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") != "ClientCertificate" {
+				t.Errorf("WWW-Authenticate = %q, want ClientCertificate", resp.Header.Get("WWW-Authenticate"))
+			}
+			if tt.wantSubject != "" && string(body) != tt.wantSubject {
+				t.Errorf("subject = %q, want %q", body, tt.wantSubject)
+			}
+		})
+	}
+}
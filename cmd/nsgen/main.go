@@ -0,0 +1,245 @@
+// Command nsgen generates Go constants for the namespaces, roles and
+// permissions of namespace configuration files of the check service, so that
+// typos in permission names are compile errors instead of 403 responses.
+//
+// Usage:
+//
+//	//go:generate go run github.com/ecociel/httprouterext/cmd/nsgen -o namespaces_gen.go namespaces/*.yaml
+//
+// For every namespace, nsgen emits a Namespace constant Ns<Name>, a Permission
+// constant Role<Name><Role> per role and a Permission constant Perm<Permission>
+// per permission. Namespaces with <ns>.get, <ns>.update or <ns>.delete
+// permissions also get a function <Name>MethodPermissions that maps HTTP methods
+// to them like httprouterext.NewMethodPermissions.
+//
+// Generation fails if the files are not a valid schema, see package schema,
+// and on names that are invalid or map to the same Go identifier.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/ecociel/httprouterext/schema"
+)
+
+func main() {
+	output := flag.String("o", "", "output file, default stdout")
+	pkg := flag.String("pkg", os.Getenv("GOPACKAGE"), "package of the generated file, default $GOPACKAGE")
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("nsgen: ")
+
+	if flag.NArg() == 0 {
+		log.Fatalf("usage: nsgen [-o file] [-pkg name] namespaces.yaml...")
+	}
+	if *pkg == "" {
+		log.Fatalf("no package, use -pkg or run with go generate")
+	}
+
+	s, err := schema.ParseFiles(flag.Args()...)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	src, err := generate(*pkg, flag.Args(), s.Namespaces)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(src)
+	} else {
+		err = os.WriteFile(*output, src, 0o644)
+	}
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+}
+
+var (
+	validName       = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+	validPermission = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*(\.[A-Za-z][A-Za-z0-9_-]*)*$`)
+)
+
+// constant is a generated constant.
+type constant struct {
+	ident, value string
+}
+
+// generate returns the formatted source of the constants for namespaces.
+func generate(pkg string, sources []string, namespaces []*schema.Namespace) ([]byte, error) {
+	idents := make(map[string]string)
+	declare := func(ident, what string) error {
+		if other, dup := idents[ident]; dup {
+			return fmt.Errorf("%s and %s both map to %s", other, what, ident)
+		}
+		idents[ident] = what
+		return nil
+	}
+
+	var nsConsts []constant
+	roleConsts := make(map[string][]constant)
+	var permissions []string
+	seenPermissions := make(map[string]bool)
+	for _, ns := range namespaces {
+		if !validName.MatchString(ns.Name) {
+			return nil, fmt.Errorf("namespace %q: invalid name", ns.Name)
+		}
+		ident := "Ns" + goName(ns.Name)
+		if err := declare(ident, "namespace "+ns.Name); err != nil {
+			return nil, err
+		}
+		nsConsts = append(nsConsts, constant{ident, ns.Name})
+
+		for _, r := range ns.Roles {
+			// The role "..." stands for any relation and has no constant.
+			if r.Name == schema.RelUnspecified {
+				continue
+			}
+			if !validName.MatchString(r.Name) {
+				return nil, fmt.Errorf("namespace %s: role %q: invalid name", ns.Name, r.Name)
+			}
+			ident := "Role" + goName(ns.Name) + goName(r.Name)
+			if err := declare(ident, "role "+ns.Name+"#"+r.Name); err != nil {
+				return nil, err
+			}
+			roleConsts[ns.Name] = append(roleConsts[ns.Name], constant{ident, r.Name})
+
+			for _, p := range r.Permissions {
+				if !validPermission.MatchString(p) {
+					return nil, fmt.Errorf("namespace %s: role %s: permission %q: invalid name", ns.Name, r.Name, p)
+				}
+				if !seenPermissions[p] {
+					seenPermissions[p] = true
+					permissions = append(permissions, p)
+				}
+			}
+		}
+	}
+
+	slices.Sort(permissions)
+	var permConsts []constant
+	for _, p := range permissions {
+		ident := "Perm" + goName(p)
+		if err := declare(ident, "permission "+p); err != nil {
+			return nil, err
+		}
+		permConsts = append(permConsts, constant{ident, p})
+	}
+
+	var b bytes.Buffer
+	b.WriteString("// Namespaces.\nconst (\n")
+	for _, c := range nsConsts {
+		fmt.Fprintf(&b, "\t%s httprouterext.Namespace = %q\n", c.ident, c.value)
+	}
+	b.WriteString(")\n\n")
+
+	for _, ns := range namespaces {
+		if len(roleConsts[ns.Name]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "// Roles of namespace %s.\nconst (\n", ns.Name)
+		for _, c := range roleConsts[ns.Name] {
+			fmt.Fprintf(&b, "\t%s httprouterext.Permission = %q\n", c.ident, c.value)
+		}
+		b.WriteString(")\n\n")
+	}
+
+	if len(permConsts) > 0 {
+		b.WriteString("// Permissions.\nconst (\n")
+		for _, c := range permConsts {
+			fmt.Fprintf(&b, "\t%s httprouterext.Permission = %q\n", c.ident, c.value)
+		}
+		b.WriteString(")\n\n")
+	}
+
+	needHTTP := false
+	for _, ns := range namespaces {
+		written, err := writeMethodPermissions(&b, ns.Name, seenPermissions, declare)
+		if err != nil {
+			return nil, err
+		}
+		needHTTP = needHTTP || written
+	}
+
+	var file bytes.Buffer
+	fmt.Fprintf(&file, "// Code generated by nsgen from %s. DO NOT EDIT.\n\n", strings.Join(sources, ", "))
+	fmt.Fprintf(&file, "package %s\n\n", pkg)
+	if needHTTP {
+		file.WriteString("import (\n\t\"net/http\"\n\n\t\"github.com/ecociel/httprouterext\"\n)\n\n")
+	} else {
+		file.WriteString("import \"github.com/ecociel/httprouterext\"\n\n")
+	}
+	file.Write(b.Bytes())
+
+	src, err := format.Source(file.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated source: %w", err)
+	}
+	return src, nil
+}
+
+// writeMethodPermissions writes the function <Name>MethodPermissions if the
+// namespace has one of the permissions <ns>.get, <ns>.update and <ns>.delete.
+// It reports whether it wrote the function.
+func writeMethodPermissions(b *bytes.Buffer, ns string, permissions map[string]bool, declare func(ident, what string) error) (bool, error) {
+	methods := []struct {
+		verb    string
+		methods []string
+	}{
+		{"get", []string{"MethodGet", "MethodHead"}},
+		{"update", []string{"MethodPost", "MethodPut", "MethodPatch"}},
+		{"delete", []string{"MethodDelete"}},
+	}
+	var lines []string
+	for _, m := range methods {
+		p := ns + "." + m.verb
+		if !permissions[p] {
+			continue
+		}
+		for _, method := range m.methods {
+			lines = append(lines, fmt.Sprintf("\t\thttp.%s: %s,\n", method, "Perm"+goName(p)))
+		}
+	}
+	if len(lines) == 0 {
+		return false, nil
+	}
+	ident := goName(ns) + "MethodPermissions"
+	if err := declare(ident, "method permissions of "+ns); err != nil {
+		return false, err
+	}
+	fmt.Fprintf(b, "// %s returns the permissions of namespace %s per HTTP method.\n", ident, ns)
+	fmt.Fprintf(b, "func %s() httprouterext.MethodPermissions {\n\treturn httprouterext.MethodPermissions{\n", ident)
+	for _, line := range lines {
+		b.WriteString(line)
+	}
+	b.WriteString("\t}\n}\n\n")
+	return true, nil
+}
+
+// goName converts a name such as "serviceaccount.createToken" or "key-admin"
+// to an exported Go identifier, "ServiceaccountCreateToken" and "KeyAdmin".
+func goName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if r == '.' || r == '-' || r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
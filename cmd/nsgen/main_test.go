@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ecociel/httprouterext/schema"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestGenerateGolden(t *testing.T) {
+	s, err := schema.ParseFiles("testdata/namespaces.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := generate("namespaces", []string{"namespaces.yaml"}, s.Namespaces)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const golden = "testdata/namespaces_gen.go.golden"
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v, run with -update to create it", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("generated source differs from %s, run with -update to accept it:\n%s", golden, got)
+	}
+}
+
+func TestGenerateRejectsNames(t *testing.T) {
+	role := func(name string, permissions ...string) *schema.Role {
+		return &schema.Role{Name: name, Permissions: permissions}
+	}
+	tests := []struct {
+		name       string
+		namespaces []*schema.Namespace
+		wantErr    string
+	}{
+		{name: "namespace with space", namespaces: []*schema.Namespace{{Name: "my ns"}}, wantErr: `namespace "my ns": invalid name`},
+		{name: "namespace with digit first", namespaces: []*schema.Namespace{{Name: "1ns"}}, wantErr: `namespace "1ns": invalid name`},
+		{name: "role", namespaces: []*schema.Namespace{{Name: "project", Roles: []*schema.Role{role("co owner")}}}, wantErr: `namespace project: role "co owner": invalid name`},
+		{name: "permission with empty segment", namespaces: []*schema.Namespace{{Name: "project", Roles: []*schema.Role{role("owner", "project..get")}}}, wantErr: `namespace project: role owner: permission "project..get": invalid name`},
+		{name: "permission with trailing dot", namespaces: []*schema.Namespace{{Name: "project", Roles: []*schema.Role{role("owner", "project.")}}}, wantErr: `permission "project.": invalid name`},
+		{name: "permission with slash", namespaces: []*schema.Namespace{{Name: "project", Roles: []*schema.Role{role("owner", "project/get")}}}, wantErr: `permission "project/get": invalid name`},
+		{name: "namespaces", namespaces: []*schema.Namespace{{Name: "a-b"}, {Name: "a_b"}}, wantErr: "namespace a-b and namespace a_b both map to NsAB"},
+		{name: "roles", namespaces: []*schema.Namespace{
+			{Name: "a-b", Roles: []*schema.Role{role("c")}},
+			{Name: "a", Roles: []*schema.Role{role("b-c")}},
+		}, wantErr: "role a-b#c and role a#b-c both map to RoleABC"},
+		{name: "permissions", namespaces: []*schema.Namespace{{Name: "a", Roles: []*schema.Role{role("x", "a.b", "a-b")}}}, wantErr: "permission a-b and permission a.b both map to PermAB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := generate("namespaces", []string{"namespaces.yaml"}, tt.namespaces)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("generate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -20,22 +20,15 @@ func (r *ArticleResource) Link() string {
 	return fmt.Sprintf("/articles/%s", r.ID)
 }
 
-func (r *ArticleResource) Requires(principalOrToken string, method string) (httprouterext.Namespace, httprouterext.Obj, httprouterext.Permission) {
-	var permission httprouterext.Permission
-	switch method {
-	case http.MethodHead:
-	case http.MethodGet:
-		permission = "article.get"
-	case http.MethodPost:
-		permission = "article.update"
-	default:
-		permission = httprouterext.Impossible
-	}
+// articlePermissions maps GET and HEAD to article.get, POST, PUT and PATCH
+// to article.update and DELETE to article.delete.
+var articlePermissions = httprouterext.NewMethodPermissions("article")
 
-	return httprouterext.Namespace("article"), httprouterext.Obj(r.ID), permission
+func (r *ArticleResource) Requires(principalOrToken string, method string) (httprouterext.Namespace, httprouterext.Obj, httprouterext.Permission) {
+	return httprouterext.Namespace("article"), httprouterext.Obj(r.ID), articlePermissions.Permission(method)
 }
 
-func ExtractArticleResource(r *http.Request, p httprouter.Params) (httprouterext.Resource, error) {
+func ExtractArticleResource(r *http.Request, p httprouter.Params) (*ArticleResource, error) {
 	id := p.ByName("id")
 	if id == "" {
 		panic("wrong router configuration")
@@ -49,9 +42,8 @@ var RouteArticleResource = ArticleResource{
 	ID: ":id",
 }
 
-func getArticle(w http.ResponseWriter, r *http.Request, p httprouter.Params, resource httprouterext.Resource, user httprouterext.User) error {
-	articleResource := resource.(*ArticleResource)
-	fmt.Fprintf(w, "Article id=%s", articleResource.ID)
+func getArticle(w http.ResponseWriter, r *http.Request, p httprouter.Params, article *ArticleResource, user httprouterext.User) error {
+	fmt.Fprintf(w, "Article id=%s", article.ID)
 	return nil
 }
 
@@ -66,9 +58,10 @@ func main() {
 
 	nioClient := httprouterext.New(conn)
 
-	router := httprouter.New()
+	router := httprouterext.NewRouter(nioClient)
 
-	router.GET(RouteArticleResource.Link(), httprouterext.Wrap(nioClient, ExtractArticleResource, getArticle))
+	httprouterext.HandleTyped(router, http.MethodGet, RouteArticleResource.Link(), ExtractArticleResource, getArticle, httprouterext.WithMethodPermissions(articlePermissions))
+	httprouterext.HandleTyped(router, http.MethodHead, RouteArticleResource.Link(), ExtractArticleResource, getArticle, httprouterext.WithMethodPermissions(articlePermissions))
 
 	log.Println("Starting server on port 8080...")
 	if err := http.ListenAndServe("127.0.0.1:8080", router); err != nil {
@@ -1,5 +1,13 @@
 package httprouterext
 
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
 // problemer is an error interface for errors that can yield a hint
 // how to fix the error. This is useful in HTTP 400, 404, 422, or 409 responses.
 type problemer interface {
@@ -7,3 +15,144 @@ type problemer interface {
 	Detail() string
 	Status() int
 }
+
+// InvalidParam describes why a single request parameter was rejected.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// Problem is an error that is rendered as a problem details response
+// (RFC 9457) when returned from a HandlerFunc.
+//
+// The cause of a problem is logged but never sent to the client.
+type Problem struct {
+	status        int
+	detail        string
+	retryAfter    time.Duration
+	invalidParams []InvalidParam
+	cause         error
+}
+
+// NewProblem creates a problem with the given HTTP status and detail.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		status: status,
+		detail: detail,
+	}
+}
+
+// BadRequest creates a 400 problem.
+func BadRequest(detail string) *Problem {
+	return NewProblem(http.StatusBadRequest, detail)
+}
+
+// NotFound creates a 404 problem.
+func NotFound(detail string) *Problem {
+	return NewProblem(http.StatusNotFound, detail)
+}
+
+// Conflict creates a 409 problem.
+func Conflict(detail string) *Problem {
+	return NewProblem(http.StatusConflict, detail)
+}
+
+// Gone creates a 410 problem.
+func Gone(detail string) *Problem {
+	return NewProblem(http.StatusGone, detail)
+}
+
+// Unprocessable creates a 422 problem.
+func Unprocessable(detail string) *Problem {
+	return NewProblem(http.StatusUnprocessableEntity, detail)
+}
+
+// TooManyRequests creates a 429 problem. The response carries a Retry-After
+// header if retryAfter is positive.
+func TooManyRequests(detail string, retryAfter time.Duration) *Problem {
+	p := NewProblem(http.StatusTooManyRequests, detail)
+	p.retryAfter = retryAfter
+	return p
+}
+
+// Invalid creates a 422 problem that lists the rejected request parameters
+// in the invalid-params member of the response.
+func Invalid(params ...InvalidParam) *Problem {
+	p := NewProblem(http.StatusUnprocessableEntity, "request parameters did not validate")
+	p.invalidParams = params
+	return p
+}
+
+// WithCause sets the underlying error of the problem.
+// The cause is logged but not included in the response.
+func (p *Problem) WithCause(err error) *Problem {
+	p.cause = err
+	return p
+}
+
+// Error returns the status text and detail of the problem, followed by the cause.
+func (p *Problem) Error() string {
+	msg := http.StatusText(p.status)
+	if p.detail != "" {
+		msg = fmt.Sprintf("%s: %s", msg, p.detail)
+	}
+	if p.cause != nil {
+		msg = fmt.Sprintf("%s: %v", msg, p.cause)
+	}
+	return msg
+}
+
+// Detail returns the human-readable explanation of the problem.
+func (p *Problem) Detail() string {
+	return p.detail
+}
+
+// Status returns the HTTP status code of the problem.
+func (p *Problem) Status() int {
+	return p.status
+}
+
+// RetryAfter returns how long the client should wait before retrying.
+func (p *Problem) RetryAfter() time.Duration {
+	return p.retryAfter
+}
+
+// InvalidParams returns the rejected request parameters.
+func (p *Problem) InvalidParams() []InvalidParam {
+	return p.invalidParams
+}
+
+// Unwrap returns the cause of the problem.
+func (p *Problem) Unwrap() error {
+	return p.cause
+}
+
+// retryAfterSeconds formats d for the Retry-After header, rounding up to whole seconds.
+func retryAfterSeconds(d time.Duration) string {
+	return fmt.Sprintf("%d", int64(math.Ceil(d.Seconds())))
+}
+
+// problemDocument is the JSON body of a problem details response.
+type problemDocument struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+	RequestID     string         `json:"request-id,omitempty"`
+}
+
+// writeProblem writes doc as an application/problem+json response.
+func writeProblem(w http.ResponseWriter, doc problemDocument) {
+	if doc.Type == "" {
+		doc.Type = "about:blank"
+	}
+	if doc.Title == "" {
+		doc.Title = http.StatusText(doc.Status)
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(doc.Status)
+	_ = json.NewEncoder(w).Encode(doc)
+}
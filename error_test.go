@@ -0,0 +1,157 @@
+package httprouterext
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// teapot is a problemer other than *Problem.
+type teapot struct{}
+
+func (teapot) Error() string  { return "short and stout" }
+func (teapot) Detail() string { return "tip me over" }
+func (teapot) Status() int    { return http.StatusTeapot }
+
+func TestMapError(t *testing.T) {
+	tests := []struct {
+		name           string
+		hdl            func(w http.ResponseWriter) error
+		wantStatus     int
+		wantDoc        *problemDocument
+		wantRetryAfter string
+		wantLog        string
+		hiddenCause    string
+	}{
+		{
+			name:       "problem",
+			hdl:        func(http.ResponseWriter) error { return NotFound("no such article") },
+			wantStatus: http.StatusNotFound,
+			wantDoc:    &problemDocument{Type: "about:blank", Title: "Not Found", Status: http.StatusNotFound, Detail: "no such article"},
+		},
+		{
+			name:       "wrapped problem",
+			hdl:        func(http.ResponseWriter) error { return fmt.Errorf("load article: %w", Conflict("version mismatch")) },
+			wantStatus: http.StatusConflict,
+			wantDoc:    &problemDocument{Type: "about:blank", Title: "Conflict", Status: http.StatusConflict, Detail: "version mismatch"},
+		},
+		{
+			name: "invalid params",
+			hdl: func(http.ResponseWriter) error {
+				return Invalid(InvalidParam{Name: "title", Reason: "must not be empty"}, InvalidParam{Name: "tags[0]", Reason: "unknown tag"})
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantDoc: &problemDocument{Type: "about:blank", Title: "Unprocessable Entity", Status: http.StatusUnprocessableEntity, Detail: "request parameters did not validate", InvalidParams: []InvalidParam{
+				{Name: "title", Reason: "must not be empty"},
+				{Name: "tags[0]", Reason: "unknown tag"},
+			}},
+		},
+		{
+			name:           "retry after rounds up",
+			hdl:            func(http.ResponseWriter) error { return TooManyRequests("slow down", 1500*time.Millisecond) },
+			wantStatus:     http.StatusTooManyRequests,
+			wantDoc:        &problemDocument{Type: "about:blank", Title: "Too Many Requests", Status: http.StatusTooManyRequests, Detail: "slow down"},
+			wantRetryAfter: "2",
+		},
+		{
+			name:           "retry after whole seconds",
+			hdl:            func(http.ResponseWriter) error { return TooManyRequests("slow down", 3*time.Second) },
+			wantStatus:     http.StatusTooManyRequests,
+			wantDoc:        &problemDocument{Type: "about:blank", Title: "Too Many Requests", Status: http.StatusTooManyRequests, Detail: "slow down"},
+			wantRetryAfter: "3",
+		},
+		{
+			name:           "retry after a millisecond",
+			hdl:            func(http.ResponseWriter) error { return TooManyRequests("slow down", time.Millisecond) },
+			wantStatus:     http.StatusTooManyRequests,
+			wantDoc:        &problemDocument{Type: "about:blank", Title: "Too Many Requests", Status: http.StatusTooManyRequests, Detail: "slow down"},
+			wantRetryAfter: "1",
+		},
+		{
+			name: "cause is logged, not sent",
+			hdl: func(http.ResponseWriter) error {
+				return NotFound("no such article").WithCause(errors.New("sql: no rows in table secret_articles"))
+			},
+			wantStatus:  http.StatusNotFound,
+			wantDoc:     &problemDocument{Type: "about:blank", Title: "Not Found", Status: http.StatusNotFound, Detail: "no such article"},
+			wantLog:     "error=Not Found: no such article: sql: no rows in table secret_articles",
+			hiddenCause: "secret_articles",
+		},
+		{
+			name:       "other problemer",
+			hdl:        func(http.ResponseWriter) error { return teapot{} },
+			wantStatus: http.StatusTeapot,
+			wantDoc:    &problemDocument{Type: "about:blank", Title: "short and stout", Status: http.StatusTeapot, Detail: "tip me over"},
+		},
+		{
+			name:        "other error",
+			hdl:         func(http.ResponseWriter) error { return errors.New("dial tcp: connection refused") },
+			wantStatus:  http.StatusInternalServerError,
+			wantDoc:     &problemDocument{Type: "about:blank", Title: "Internal Server Error", Status: http.StatusInternalServerError},
+			wantLog:     "error=dial tcp: connection refused",
+			hiddenCause: "connection refused",
+		},
+		{
+			name: "headers already sent",
+			hdl: func(w http.ResponseWriter) error {
+				w.WriteHeader(http.StatusAccepted)
+				w.Write([]byte("partial"))
+				return NotFound("no such article")
+			},
+			wantStatus: http.StatusAccepted,
+			wantLog:    "error=Not Found: no such article",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			defer log.SetOutput(log.Writer())
+			log.SetOutput(&logs)
+
+			w := httptest.NewRecorder()
+			Observe(w, httptest.NewRequest(http.MethodGet, "/articles/1", nil), tt.hdl)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			if tt.wantDoc != nil {
+				if got := w.Header().Get("Content-Type"); got != "application/problem+json" {
+					t.Errorf("Content-Type = %q", got)
+				}
+				var doc problemDocument
+				if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+					t.Fatal(err)
+				}
+				if doc.RequestID == "" || doc.RequestID != w.Header().Get("X-Request-Id") {
+					t.Errorf("request-id = %q, want the X-Request-Id %q", doc.RequestID, w.Header().Get("X-Request-Id"))
+				}
+				doc.RequestID = ""
+				if !reflect.DeepEqual(&doc, tt.wantDoc) {
+					t.Errorf("problem = %+v, want %+v", doc, *tt.wantDoc)
+				}
+			} else if got := w.Body.String(); got != "partial" {
+				t.Errorf("body = %q, want the partial response only", got)
+			}
+			if tt.hiddenCause != "" && strings.Contains(w.Body.String(), tt.hiddenCause) {
+				t.Errorf("body %s contains the cause", w.Body.String())
+			}
+			if tt.wantLog != "" && !strings.Contains(logs.String(), tt.wantLog) {
+				t.Errorf("log %q lacks %q", logs.String(), tt.wantLog)
+			}
+			if tt.wantLog == "" && strings.Contains(logs.String(), "error=") {
+				t.Errorf("log %q, want no error for a problem without cause", logs.String())
+			}
+		})
+	}
+}
@@ -6,8 +6,10 @@ toolchain go1.24.5
 
 require (
 	github.com/julienschmidt/httprouter v1.3.0
+	golang.org/x/crypto v0.43.0
 	google.golang.org/grpc v1.77.0
 	google.golang.org/protobuf v1.36.10
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,191 @@
+package httprouterext
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// HtpasswdFile is a BasicWrapper that verifies users against an Apache htpasswd
+// file with bcrypt ($2y$, $2a$, $2b$) or SHA-512 crypt ($6$) entries.
+//
+// The file is reloaded when it changes. Requests keep being served with the
+// previous users while the file is reloaded, and if it cannot be parsed.
+//
+// Unknown users are verified against a dummy hash of the same kind and cost
+// as the entries of the file, so that the response time does not reveal
+// whether a user exists.
+type HtpasswdFile struct {
+	file *watchedFile
+
+	mu    sync.RWMutex
+	users map[string]string
+	dummy string
+}
+
+// NewHtpasswdFile loads the htpasswd file at path.
+func NewHtpasswdFile(path string) (*HtpasswdFile, error) {
+	f := &HtpasswdFile{
+		file: &watchedFile{path: path, checkInterval: time.Second},
+	}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// WithCheckInterval sets how often the file is checked for changes.
+// The default is one second.
+func (f *HtpasswdFile) WithCheckInterval(d time.Duration) *HtpasswdFile {
+	f.file.checkInterval = d
+	return f
+}
+
+// Authenticate authenticates a user with a username and password.
+// It returns whether the authentication was successful and an error.
+func (f *HtpasswdFile) Authenticate(_ context.Context, username, password []byte) (bool, error) {
+	if err := f.file.reloadIfChanged(f.load); err != nil {
+		log.Printf("keep previous users: htpasswd: %v", err)
+	}
+
+	f.mu.RLock()
+	hash, found := f.users[string(username)]
+	dummy := f.dummy
+	f.mu.RUnlock()
+
+	if !found {
+		hash = dummy
+	}
+	ok, err := verifyPasswordHash(hash, password)
+	if err != nil {
+		return false, fmt.Errorf("htpasswd %s: %w", f.file.path, err)
+	}
+	return ok && found, nil
+}
+
+// Reload reads the file. On error, the previously loaded users remain in effect.
+func (f *HtpasswdFile) Reload() error {
+	if err := f.file.reload(f.load); err != nil {
+		return fmt.Errorf("htpasswd: %w", err)
+	}
+	return nil
+}
+
+// load replaces the users by those of data.
+func (f *HtpasswdFile) load(data []byte) error {
+	users, err := parseHtpasswd(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.file.path, err)
+	}
+	dummy, err := dummyPasswordHash(users)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.file.path, err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users = users
+	f.dummy = dummy
+	return nil
+}
+
+// parseHtpasswd parses the lines user:hash of an htpasswd file.
+func parseHtpasswd(data []byte) (map[string]string, error) {
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		username, hash, ok := strings.Cut(text, ":")
+		if !ok || username == "" {
+			return nil, fmt.Errorf("line %d: expected user:hash", line)
+		}
+		if _, err := passwordHashKind(hash); err != nil {
+			return nil, fmt.Errorf("line %d: user %s: %w", line, username, err)
+		}
+		if _, dup := users[username]; dup {
+			return nil, fmt.Errorf("line %d: duplicate user %s", line, username)
+		}
+		users[username] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+const (
+	hashBcrypt = "bcrypt"
+	hashSHA512 = "sha512-crypt"
+)
+
+// passwordHashKind returns the kind of hash, or an error for unsupported hashes.
+func passwordHashKind(hash string) (string, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2y$"), strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"):
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return "", err
+		}
+		return hashBcrypt, nil
+	case strings.HasPrefix(hash, sha512CryptPrefix):
+		if _, err := parseSHA512Crypt(hash); err != nil {
+			return "", err
+		}
+		return hashSHA512, nil
+	default:
+		return "", fmt.Errorf("unsupported password hash, use bcrypt or SHA-512 crypt")
+	}
+}
+
+// verifyPasswordHash reports whether password matches hash.
+func verifyPasswordHash(hash string, password []byte) (bool, error) {
+	kind, err := passwordHashKind(hash)
+	if err != nil {
+		return false, err
+	}
+	switch kind {
+	case hashBcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(hash), password)
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+	default:
+		params, _ := parseSHA512Crypt(hash)
+		computed := sha512Crypt(password, params)
+		return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1, nil
+	}
+}
+
+// dummyPasswordHash returns a hash of a random password that costs as much to
+// verify as an entry of users. Files are expected to use one kind and cost of hash.
+func dummyPasswordHash(users map[string]string) (string, error) {
+	var secret [16]byte
+	_, _ = rand.Read(secret[:])
+	password := []byte(hex.EncodeToString(secret[:]))
+
+	for _, hash := range users {
+		if kind, _ := passwordHashKind(hash); kind == hashSHA512 {
+			params, _ := parseSHA512Crypt(hash)
+			params.salt = hex.EncodeToString(secret[:8])
+			return sha512Crypt(password, params), nil
+		}
+		cost, _ := bcrypt.Cost([]byte(hash))
+		dummy, err := bcrypt.GenerateFromPassword(password, cost)
+		return string(dummy), err
+	}
+	dummy, err := bcrypt.GenerateFromPassword(password, bcrypt.DefaultCost)
+	return string(dummy), err
+}
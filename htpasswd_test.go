@@ -0,0 +1,121 @@
+package httprouterext
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptHash returns a bcrypt hash of password with prefix, e.g. "$2y$" as
+// written by htpasswd -B.
+func bcryptHash(t *testing.T, prefix, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prefix + string(hash[len("$2a$"):])
+}
+
+// writeHtpasswd writes lines to the htpasswd file at path.
+func writeHtpasswd(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHtpasswdFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	writeHtpasswd(t, path,
+		"# users",
+		"alice:"+bcryptHash(t, "$2y$", "alice secret"),
+		"bob:"+bcryptHash(t, "$2b$", "bob secret"),
+		"carol:"+bcryptHash(t, "$2a$", "carol secret"),
+		// openssl passwd -6 -salt abc secret
+		"dave:$6$abc$IdWKNKTJEb8LxY7CGg8YBXlvtfZzFw7Mp/r6niK9YB2mdvgY..TKjv1T..8RadRt2qvUHYRLr/TsVArtr91iR1",
+	)
+	f, err := NewHtpasswdFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		username, password string
+		want               bool
+	}{
+		{"alice", "alice secret", true},
+		{"alice", "bob secret", false},
+		{"bob", "bob secret", true},
+		{"carol", "carol secret", true},
+		{"dave", "secret", true},
+		{"dave", "Secret", false},
+		{"eve", "alice secret", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.username+":"+tt.password, func(t *testing.T) {
+			ok, err := f.Authenticate(context.Background(), []byte(tt.username), []byte(tt.password))
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if ok != tt.want {
+				t.Errorf("Authenticate() = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestHtpasswdFileInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "no hash", line: "alice"},
+		{name: "md5", line: "alice:$apr1$abc$def"},
+		{name: "plain", line: "alice:secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "htpasswd")
+			writeHtpasswd(t, path, tt.line)
+			if _, err := NewHtpasswdFile(path); err == nil {
+				t.Error("NewHtpasswdFile() accepted an invalid file")
+			}
+		})
+	}
+}
+
+func TestHtpasswdFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	writeHtpasswd(t, path, "alice:"+bcryptHash(t, "$2y$", "secret"))
+	f, err := NewHtpasswdFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WithCheckInterval(0)
+
+	authenticate := func(username string) bool {
+		t.Helper()
+		ok, err := f.Authenticate(context.Background(), []byte(username), []byte("secret"))
+		if err != nil {
+			t.Fatalf("Authenticate() error = %v", err)
+		}
+		return ok
+	}
+
+	// The changed size is detected even if the modification time is not.
+	writeHtpasswd(t, path, "bob:"+bcryptHash(t, "$2y$", "secret"), "# added bob, removed alice")
+	if authenticate("alice") || !authenticate("bob") {
+		t.Error("the changed file was not reloaded")
+	}
+
+	// A file that cannot be parsed keeps the previous users in effect.
+	writeHtpasswd(t, path, "bob")
+	if !authenticate("bob") {
+		t.Error("the previous users were dropped for an invalid file")
+	}
+}
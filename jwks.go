@@ -0,0 +1,229 @@
+package httprouterext
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// JSONWebKey is a public key of a JSON Web Key Set.
+type JSONWebKey struct {
+	// KeyID is the kid that tokens signed with the key refer to.
+	KeyID string
+	// Algorithm restricts the key to one signature algorithm, if set.
+	Algorithm string
+	// Key is an *rsa.PublicKey, an *ecdsa.PublicKey or an ed25519.PublicKey.
+	Key crypto.PublicKey
+}
+
+// KeySet looks up the keys that verify signed tokens.
+type KeySet interface {
+	// Key returns the key with the given kid. If kid is empty, a set with
+	// a single key returns that key.
+	Key(kid string) (JSONWebKey, bool)
+}
+
+// JWKS is an in-memory KeySet. Keys are rotated by adding the new key under
+// a new kid and removing the old key once no token signed with it is valid.
+type JWKS struct {
+	keys map[string]JSONWebKey
+}
+
+// NewJWKS creates a key set of keys. Key IDs must be unique.
+func NewJWKS(keys ...JSONWebKey) (*JWKS, error) {
+	set := &JWKS{
+		keys: make(map[string]JSONWebKey, len(keys)),
+	}
+	for _, key := range keys {
+		switch key.Key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		default:
+			return nil, fmt.Errorf("key %q: unsupported key type %T", key.KeyID, key.Key)
+		}
+		if _, dup := set.keys[key.KeyID]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", key.KeyID)
+		}
+		set.keys[key.KeyID] = key
+	}
+	return set, nil
+}
+
+// ParseJWKS parses a JSON Web Key Set (RFC 7517) with RSA, P-256 and Ed25519 keys.
+// Keys whose use is not "sig" are skipped. Keys that are unsupported, such as
+// P-384 keys, or invalid, such as RSA keys shorter than 2048 bits, are logged
+// and skipped, so that they do not disable the other keys of the set.
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+
+	var keys []JSONWebKey
+	for i, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key := JSONWebKey{KeyID: k.Kid, Algorithm: k.Alg}
+		var err error
+		switch {
+		case k.Kty == "RSA":
+			key.Key, err = rsaPublicKey(k.N, k.E)
+		case k.Kty == "EC" && k.Crv == "P-256":
+			key.Key, err = ecdsaPublicKey(k.X, k.Y)
+		case k.Kty == "OKP" && k.Crv == "Ed25519":
+			var x []byte
+			x, err = base64.RawURLEncoding.DecodeString(k.X)
+			if err == nil && len(x) != ed25519.PublicKeySize {
+				err = errors.New("invalid Ed25519 key size")
+			}
+			key.Key = ed25519.PublicKey(x)
+		default:
+			err = fmt.Errorf("unsupported key type %s %s", k.Kty, k.Crv)
+		}
+		if err != nil {
+			log.Printf("jwks: skip key %d (%q): %v", i, k.Kid, err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	set, err := NewJWKS(keys...)
+	if err != nil {
+		return nil, fmt.Errorf("parse jwks: %w", err)
+	}
+	return set, nil
+}
+
+// Key returns the key with the given kid.
+func (s *JWKS) Key(kid string) (JSONWebKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+func rsaPublicKey(n, e string) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("decode n: %w", err)
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, fmt.Errorf("decode e: %w", err)
+	}
+	exponent := new(big.Int).SetBytes(eBytes)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid RSA exponent")
+	}
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: int(exponent.Int64())}
+	if key.N.BitLen() < 2048 {
+		return nil, errors.New("RSA key shorter than 2048 bits")
+	}
+	return key, nil
+}
+
+func ecdsaPublicKey(x, y string) (*ecdsa.PublicKey, error) {
+	xBytes, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, fmt.Errorf("decode x: %w", err)
+	}
+	yBytes, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, fmt.Errorf("decode y: %w", err)
+	}
+	if len(xBytes) != 32 || len(yBytes) != 32 {
+		return nil, errors.New("invalid P-256 coordinate size")
+	}
+	// crypto/ecdh validates that the point is on the curve.
+	point := append([]byte{4}, append(xBytes, yBytes...)...)
+	if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+		return nil, fmt.Errorf("invalid P-256 key: %w", err)
+	}
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(xBytes),
+		Y:     new(big.Int).SetBytes(yBytes),
+	}, nil
+}
+
+// JWKSFile is a KeySet loaded from a JSON Web Key Set file. The file is
+// reloaded when it changes, so keys can be rotated without a restart.
+type JWKSFile struct {
+	file *watchedFile
+
+	mu  sync.RWMutex
+	set *JWKS
+}
+
+// NewJWKSFile loads the JSON Web Key Set file at path.
+func NewJWKSFile(path string) (*JWKSFile, error) {
+	f := &JWKSFile{
+		file: &watchedFile{path: path, checkInterval: 10 * time.Second},
+	}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// WithCheckInterval sets how often the file is checked for changes.
+// The default is ten seconds.
+func (f *JWKSFile) WithCheckInterval(d time.Duration) *JWKSFile {
+	f.file.checkInterval = d
+	return f
+}
+
+// Reload reads the file. On error, the previously loaded keys remain in effect.
+func (f *JWKSFile) Reload() error {
+	if err := f.file.reload(f.load); err != nil {
+		return fmt.Errorf("jwks: %w", err)
+	}
+	return nil
+}
+
+// load replaces the keys by those of data.
+func (f *JWKSFile) load(data []byte) error {
+	set, err := ParseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.file.path, err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.set = set
+	return nil
+}
+
+// Key returns the key with the given kid.
+func (f *JWKSFile) Key(kid string) (JSONWebKey, bool) {
+	if err := f.file.reloadIfChanged(f.load); err != nil {
+		log.Printf("keep previous keys: jwks: %v", err)
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.set.Key(kid)
+}
@@ -0,0 +1,203 @@
+package httprouterext
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// JWTAuthenticator authenticates requests by a JSON Web Token (RFC 7519) in an
+// "Authorization: Bearer" header. Tokens must be signed with RS256, ES256 or
+// EdDSA by a key of the key set, and their iss, aud, exp and nbf claims must
+// be valid. The user ID is taken from the sub claim, or another configured claim.
+//
+// Bearer tokens that are not JWTs are left to other authenticators of a Chain.
+type JWTAuthenticator struct {
+	keys      KeySet
+	issuer    string
+	audience  string
+	claim     string
+	clockSkew time.Duration
+	now       func() time.Time
+}
+
+// NewJWTAuthenticator creates an authenticator for tokens that are issued by
+// issuer for audience and signed by a key of keys.
+func NewJWTAuthenticator(keys KeySet, issuer, audience string) *JWTAuthenticator {
+	return &JWTAuthenticator{
+		keys:      keys,
+		issuer:    issuer,
+		audience:  audience,
+		claim:     "sub",
+		clockSkew: time.Minute,
+		now:       time.Now,
+	}
+}
+
+// WithClaim sets the claim that holds the user ID. The default is "sub".
+func (a *JWTAuthenticator) WithClaim(name string) *JWTAuthenticator {
+	a.claim = name
+	return a
+}
+
+// WithClockSkew sets the tolerance for the exp and nbf claims. The default is one minute.
+func (a *JWTAuthenticator) WithClockSkew(d time.Duration) *JWTAuthenticator {
+	a.clockSkew = d
+	return a
+}
+
+// Authenticate returns the subject identified by the token.
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (Subject, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return Subject{}, err
+	}
+	if strings.Count(token, ".") != 2 {
+		return Subject{}, ErrNoCredentials
+	}
+	userId, err := a.verify(token)
+	if err != nil {
+		return Subject{}, err
+	}
+	return Subject{
+		UserId: UserId(userId),
+		Scheme: "jwt",
+	}, nil
+}
+
+// Challenges returns the Bearer challenge.
+func (a *JWTAuthenticator) Challenges() []string {
+	return []string{"Bearer"}
+}
+
+// verify checks the signature and claims of token and returns the user ID.
+func (a *JWTAuthenticator) verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return "", invalidCredentials("malformed token header")
+	}
+	key, ok := a.keys.Key(header.Kid)
+	if !ok {
+		return "", invalidCredentials("unknown signing key")
+	}
+	if key.Algorithm != "" && key.Algorithm != header.Alg {
+		return "", invalidCredentials("signing algorithm does not match key")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", invalidCredentials("malformed token signature")
+	}
+	if !verifyJWTSignature(header.Alg, key.Key, []byte(parts[0]+"."+parts[1]), signature) {
+		return "", invalidCredentials("invalid token signature")
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return "", invalidCredentials("malformed token claims")
+	}
+	now := a.now()
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return "", invalidCredentials("token has no expiry")
+	}
+	if now.After(exp.Add(a.clockSkew)) {
+		return "", invalidCredentials("token expired")
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(a.clockSkew).Before(nbf) {
+		return "", invalidCredentials("token not yet valid")
+	}
+	if iss, _ := claims["iss"].(string); a.issuer != "" && iss != a.issuer {
+		return "", invalidCredentials("unexpected token issuer")
+	}
+	if a.audience != "" && !hasAudience(claims["aud"], a.audience) {
+		return "", invalidCredentials("unexpected token audience")
+	}
+	userId, _ := claims[a.claim].(string)
+	if userId == "" {
+		return "", invalidCredentials("token has no " + a.claim + " claim")
+	}
+	return userId, nil
+}
+
+// decodeJWTPart decodes a base64url encoded JSON part of a token.
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// verifyJWTSignature verifies signature with key according to alg.
+// The type of key must match alg, which rules out algorithm confusion.
+func verifyJWTSignature(alg string, key crypto.PublicKey, signingInput, signature []byte) bool {
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+		sum := sha256.Sum256(signingInput)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], signature) == nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve.Params().BitSize != 256 || len(signature) != 64 {
+			return false
+		}
+		sum := sha256.Sum256(signingInput)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, sum[:], r, s)
+	case "EdDSA":
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return false
+		}
+		return ed25519.Verify(pub, signingInput, signature)
+	default:
+		return false
+	}
+}
+
+// numericDate converts a NumericDate claim.
+func numericDate(v any) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// hasAudience reports whether the aud claim, a string or an array of strings, contains audience.
+func hasAudience(aud any, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
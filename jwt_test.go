@@ -0,0 +1,306 @@
+package httprouterext
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSigner signs tokens with a key of one algorithm.
+type testSigner struct {
+	alg  string
+	kid  string
+	sign func(signingInput []byte) []byte
+	jwk  map[string]string
+	pub  crypto.PublicKey
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func newRS256Signer(t *testing.T, kid string, bits int) *testSigner {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{
+		alg: "RS256",
+		kid: kid,
+		sign: func(signingInput []byte) []byte {
+			sum := sha256.Sum256(signingInput)
+			sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return sig
+		},
+		jwk: map[string]string{"kty": "RSA", "kid": kid, "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())},
+		pub: &key.PublicKey,
+	}
+}
+
+func newES256Signer(t *testing.T, kid string) *testSigner {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{
+		alg: "ES256",
+		kid: kid,
+		sign: func(signingInput []byte) []byte {
+			sum := sha256.Sum256(signingInput)
+			r, s, err := ecdsa.Sign(rand.Reader, key, sum[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig := make([]byte, 64)
+			r.FillBytes(sig[:32])
+			s.FillBytes(sig[32:])
+			return sig
+		},
+		jwk: map[string]string{"kty": "EC", "crv": "P-256", "kid": kid, "x": b64(key.X.FillBytes(make([]byte, 32))), "y": b64(key.Y.FillBytes(make([]byte, 32)))},
+		pub: &key.PublicKey,
+	}
+}
+
+func newEdDSASigner(t *testing.T, kid string) *testSigner {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{
+		alg: "EdDSA",
+		kid: kid,
+		sign: func(signingInput []byte) []byte {
+			return ed25519.Sign(key, signingInput)
+		},
+		jwk: map[string]string{"kty": "OKP", "crv": "Ed25519", "kid": kid, "x": b64(pub)},
+		pub: pub,
+	}
+}
+
+// token returns a token with header and claims signed by s.
+func (s *testSigner) token(t *testing.T, header map[string]any, claims map[string]any) string {
+	t.Helper()
+	if header == nil {
+		header = map[string]any{"alg": s.alg, "kid": s.kid}
+	}
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := b64(h) + "." + b64(c)
+	return signingInput + "." + b64(s.sign([]byte(signingInput)))
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	rs := newRS256Signer(t, "rs", 2048)
+	es := newES256Signer(t, "es")
+	ed := newEdDSASigner(t, "ed")
+	other := newES256Signer(t, "es")
+	keys, err := NewJWKS(
+		JSONWebKey{KeyID: rs.kid, Key: rs.pub},
+		JSONWebKey{KeyID: es.kid, Algorithm: "ES256", Key: es.pub},
+		JSONWebKey{KeyID: ed.kid, Key: ed.pub},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewJWTAuthenticator(keys, "https://issuer.example", "api")
+	auth.now = func() time.Time { return now }
+
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{
+			"iss": "https://issuer.example",
+			"aud": "api",
+			"sub": "alice",
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	unsigned := func(header map[string]any, claims map[string]any) string {
+		h, _ := json.Marshal(header)
+		c, _ := json.Marshal(claims)
+		return b64(h) + "." + b64(c) + "."
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{name: "RS256", token: rs.token(t, nil, claims(nil))},
+		{name: "ES256", token: es.token(t, nil, claims(nil))},
+		{name: "EdDSA", token: ed.token(t, nil, claims(nil))},
+		{name: "audience array", token: rs.token(t, nil, claims(map[string]any{"aud": []string{"other", "api"}}))},
+		{name: "expired within clock skew", token: rs.token(t, nil, claims(map[string]any{"exp": now.Add(-30 * time.Second).Unix()}))},
+		{name: "not before within clock skew", token: rs.token(t, nil, claims(map[string]any{"nbf": now.Add(30 * time.Second).Unix()}))},
+		{name: "alg none", token: unsigned(map[string]any{"alg": "none", "kid": "rs"}, claims(nil)), wantErr: "invalid token signature"},
+		{name: "alg none without kid", token: unsigned(map[string]any{"alg": "none"}, claims(nil)), wantErr: "unknown signing key"},
+		{name: "alg of another key type", token: rs.token(t, map[string]any{"alg": "ES256", "kid": "rs"}, claims(nil)), wantErr: "invalid token signature"},
+		{name: "HS256 with a public key", token: rs.token(t, map[string]any{"alg": "HS256", "kid": "rs"}, claims(nil)), wantErr: "invalid token signature"},
+		{name: "alg of the key restricted", token: es.token(t, map[string]any{"alg": "EdDSA", "kid": "es"}, claims(nil)), wantErr: "signing algorithm does not match key"},
+		{name: "kid of another key", token: other.token(t, nil, claims(nil)), wantErr: "invalid token signature"},
+		{name: "unknown kid", token: rs.token(t, map[string]any{"alg": "RS256", "kid": "unknown"}, claims(nil)), wantErr: "unknown signing key"},
+		{name: "no kid with several keys", token: rs.token(t, map[string]any{"alg": "RS256"}, claims(nil)), wantErr: "unknown signing key"},
+		{name: "expired", token: rs.token(t, nil, claims(map[string]any{"exp": now.Add(-2 * time.Minute).Unix()})), wantErr: "token expired"},
+		{name: "no expiry", token: rs.token(t, nil, claims(map[string]any{"exp": nil})), wantErr: "token has no expiry"},
+		{name: "not yet valid", token: rs.token(t, nil, claims(map[string]any{"nbf": now.Add(2 * time.Minute).Unix()})), wantErr: "token not yet valid"},
+		{name: "wrong issuer", token: rs.token(t, nil, claims(map[string]any{"iss": "https://other.example"})), wantErr: "unexpected token issuer"},
+		{name: "no issuer", token: rs.token(t, nil, claims(map[string]any{"iss": nil})), wantErr: "unexpected token issuer"},
+		{name: "wrong audience", token: rs.token(t, nil, claims(map[string]any{"aud": "other"})), wantErr: "unexpected token audience"},
+		{name: "audience array without audience", token: rs.token(t, nil, claims(map[string]any{"aud": []string{"other"}})), wantErr: "unexpected token audience"},
+		{name: "no subject", token: rs.token(t, nil, claims(map[string]any{"sub": nil})), wantErr: "token has no sub claim"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			subject, err := auth.Authenticate(r)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Authenticate() error = %v", err)
+				}
+				if subject.UserId != "alice" || subject.Scheme != "jwt" {
+					t.Errorf("Authenticate() = %+v, want alice by jwt", subject)
+				}
+				return
+			}
+			var credentialsErr *CredentialsError
+			if !errors.As(err, &credentialsErr) || credentialsErr.Reason != tt.wantErr {
+				t.Errorf("Authenticate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticatorTamperedClaims(t *testing.T) {
+	es := newES256Signer(t, "es")
+	keys, err := NewJWKS(JSONWebKey{KeyID: es.kid, Key: es.pub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewJWTAuthenticator(keys, "", "")
+	token := es.token(t, nil, map[string]any{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})
+	forged, _ := json.Marshal(map[string]any{"sub": "admin", "exp": time.Now().Add(time.Hour).Unix()})
+	parts := strings.Split(token, ".")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+parts[0]+"."+b64(forged)+"."+parts[2])
+	if _, err := auth.Authenticate(r); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate() error = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestJWTAuthenticatorOpaqueToken(t *testing.T) {
+	keys, err := NewJWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer opaque")
+	if _, err := NewJWTAuthenticator(keys, "", "").Authenticate(r); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Authenticate() error = %v, want ErrNoCredentials", err)
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	rs := newRS256Signer(t, "rs", 2048)
+	short := newRS256Signer(t, "short", 1024)
+	ed := newEdDSASigner(t, "ed")
+	p384 := map[string]string{"kty": "EC", "crv": "P-384", "kid": "p384", "x": "AA", "y": "AA"}
+	enc := newES256Signer(t, "enc")
+	enc.jwk["use"] = "enc"
+
+	data, err := json.Marshal(map[string]any{"keys": []map[string]string{rs.jwk, short.jwk, p384, ed.jwk, enc.jwk}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := ParseJWKS(data)
+	if err != nil {
+		t.Fatalf("ParseJWKS() error = %v", err)
+	}
+	for kid, want := range map[string]bool{"rs": true, "ed": true, "short": false, "p384": false, "enc": false} {
+		if _, ok := set.Key(kid); ok != want {
+			t.Errorf("Key(%q) found = %v, want %v", kid, ok, want)
+		}
+	}
+
+	auth := NewJWTAuthenticator(set, "", "")
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+ed.token(t, nil, map[string]any{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}))
+	if _, err := auth.Authenticate(r); err != nil {
+		t.Errorf("Authenticate() with a parsed key error = %v", err)
+	}
+}
+
+func TestJWKSFileReload(t *testing.T) {
+	a := newEdDSASigner(t, "a")
+	b := newEdDSASigner(t, "b")
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	write := func(keys ...map[string]string) {
+		t.Helper()
+		data, err := json.Marshal(map[string]any{"keys": keys})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(a.jwk)
+	f, err := NewJWKSFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WithCheckInterval(0)
+
+	// The changed size is detected even if the modification time is not.
+	modTime := f.file.modTime
+	write(a.jwk, b.jwk)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.Key("b"); !ok {
+		t.Error("the changed file was not reloaded")
+	}
+
+	// A file that cannot be parsed keeps the previous keys in effect.
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.Key("b"); !ok {
+		t.Error("the previous keys were dropped for an invalid file")
+	}
+}
@@ -0,0 +1,64 @@
+package httprouterext
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// MethodPermissions maps HTTP methods to the permission they require.
+// Methods without a mapping require Impossible.
+type MethodPermissions map[string]Permission
+
+// NewMethodPermissions returns the mapping of the <ns>.<verb> convention of
+// the namespace configuration:
+//
+//	GET, HEAD        -> <ns>.get
+//	POST, PUT, PATCH -> <ns>.update
+//	DELETE           -> <ns>.delete
+func NewMethodPermissions(ns Namespace) MethodPermissions {
+	get := Permission(string(ns) + ".get")
+	update := Permission(string(ns) + ".update")
+	return MethodPermissions{
+		http.MethodGet:    get,
+		http.MethodHead:   get,
+		http.MethodPost:   update,
+		http.MethodPut:    update,
+		http.MethodPatch:  update,
+		http.MethodDelete: Permission(string(ns) + ".delete"),
+	}
+}
+
+// With returns a copy of m in which method requires permission.
+func (m MethodPermissions) With(method string, permission Permission) MethodPermissions {
+	c := make(MethodPermissions, len(m)+1)
+	for k, v := range m {
+		c[k] = v
+	}
+	c[method] = permission
+	return c
+}
+
+// Permission returns the permission method requires, or Impossible if it has no mapping.
+func (m MethodPermissions) Permission(method string) Permission {
+	if permission, ok := m[method]; ok && permission != "" {
+		return permission
+	}
+	return Impossible
+}
+
+// Covers returns an error listing the methods that have no mapping.
+func (m MethodPermissions) Covers(methods ...string) error {
+	var missing []string
+	for _, method := range methods {
+		if permission, ok := m[method]; !ok || permission == "" {
+			missing = append(missing, method)
+		}
+	}
+	if len(missing) > 0 {
+		slices.Sort(missing)
+		return fmt.Errorf("no permission for method %s", strings.Join(slices.Compact(missing), ", "))
+	}
+	return nil
+}
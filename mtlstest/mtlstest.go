@@ -0,0 +1,162 @@
+// Package mtlstest generates throwaway certificate authorities and client
+// certificates for testing servers that authenticate clients with mTLS.
+package mtlstest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+)
+
+// CA is a certificate authority that only lives in memory.
+type CA struct {
+	Cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// NewCA creates a CA with a new P-256 key that is valid for a day.
+func NewCA() (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate ca key: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{CommonName: "mtlstest CA"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("create ca certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse ca certificate: %w", err)
+	}
+	return &CA{Cert: cert, key: key}, nil
+}
+
+// Pool returns a pool that contains the CA certificate, for use as
+// tls.Config.ClientCAs or RootCAs.
+func (ca *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	return pool
+}
+
+// Identity describes the names of an issued certificate.
+type Identity struct {
+	CommonName string
+	// SPIFFEID is added as a URI SAN, e.g. "spiffe://example.org/ns/prod/sa/billing".
+	SPIFFEID string
+	Emails   []string
+	DNSNames []string
+	IPs      []net.IP
+	// NotBefore and NotAfter default to a minute ago and an hour from now.
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// IssueClient issues a certificate for client authentication.
+func (ca *CA) IssueClient(id Identity) (tls.Certificate, error) {
+	return ca.issue(id, x509.ExtKeyUsageClientAuth)
+}
+
+// IssueServer issues a certificate for server authentication.
+func (ca *CA) IssueServer(id Identity) (tls.Certificate, error) {
+	return ca.issue(id, x509.ExtKeyUsageServerAuth)
+}
+
+// ServerConfig returns a TLS configuration for a server with a certificate for
+// localhost that verifies client certificates issued by the CA if given.
+func (ca *CA) ServerConfig() (*tls.Config, error) {
+	cert, err := ca.IssueServer(Identity{
+		CommonName: "localhost",
+		DNSNames:   []string{"localhost"},
+		IPs:        []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    ca.Pool(),
+	}, nil
+}
+
+// ClientConfig returns a TLS configuration for a client that trusts the CA and
+// presents a certificate issued for id.
+func (ca *CA) ClientConfig(id Identity) (*tls.Config, error) {
+	cert, err := ca.IssueClient(id)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      ca.Pool(),
+	}, nil
+}
+
+func (ca *CA) issue(id Identity, usage x509.ExtKeyUsage) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generate key: %w", err)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:   serialNumber(),
+		Subject:        pkix.Name{CommonName: id.CommonName},
+		NotBefore:      id.NotBefore,
+		NotAfter:       id.NotAfter,
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{usage},
+		EmailAddresses: id.Emails,
+		DNSNames:       id.DNSNames,
+		IPAddresses:    id.IPs,
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = now.Add(-time.Minute)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = now.Add(time.Hour)
+	}
+	if id.SPIFFEID != "" {
+		uri, err := url.Parse(id.SPIFFEID)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("parse spiffe id: %w", err)
+		}
+		template.URIs = []*url.URL{uri}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("create certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("parse certificate: %w", err)
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+func serialNumber() *big.Int {
+	n, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	return n
+}
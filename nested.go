@@ -0,0 +1,151 @@
+package httprouterext
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// ObjectResource is a resource that corresponds to an object of the check
+// service. The resources of nested routes implement it, so that their parent
+// relation can be verified.
+type ObjectResource interface {
+	Resource
+	Object() (Namespace, Obj)
+}
+
+// ParentVerifier verifies the parent relations written by Client.AddParent.
+// *Client implements it.
+type ParentVerifier interface {
+	HasParent(ctx context.Context, ns Namespace, obj Obj, parentNs Namespace, parentObj Obj) (bool, error)
+}
+
+// ResourceChain is the chain of resources of a nested route such as
+// /projects/:pid/articles/:id, from the outermost parent to the addressed
+// resource. It requires what its last resource requires.
+type ResourceChain struct {
+	resources []Resource
+	// parents are the parent relations to verify, see Nest.
+	parents []parentRelation
+}
+
+// parentRelation is a relation between two resources of a chain that verifier verifies.
+type parentRelation struct {
+	verifier      ParentVerifier
+	parent, child Resource
+}
+
+// Resources returns the resources of the chain, outermost first.
+func (c *ResourceChain) Resources() []Resource {
+	return c.resources
+}
+
+// Leaf returns the addressed resource.
+func (c *ResourceChain) Leaf() Resource {
+	return c.resources[len(c.resources)-1]
+}
+
+// Requires returns the permission the addressed resource requires.
+func (c *ResourceChain) Requires(principalOrToken string, method string) (Namespace, Obj, Permission) {
+	return c.Leaf().Requires(principalOrToken, method)
+}
+
+// Requirement returns the requirement of the addressed resource.
+func (c *ResourceChain) Requirement(principalOrToken string, method string) Requirement {
+	if requirer, ok := c.Leaf().(Requirer); ok {
+		return requirer.Requirement(principalOrToken, method)
+	}
+	return Require(c.Leaf().Requires(principalOrToken, method))
+}
+
+// ResourceOf returns the resource of type R. If resource is a *ResourceChain,
+// the innermost resource of type R in the chain is returned.
+func ResourceOf[R Resource](resource Resource) (R, bool) {
+	if chain, ok := resource.(*ResourceChain); ok {
+		for i := len(chain.resources) - 1; i >= 0; i-- {
+			if r, ok := chain.resources[i].(R); ok {
+				return r, true
+			}
+		}
+		var zero R
+		return zero, false
+	}
+	r, ok := resource.(R)
+	return r, ok
+}
+
+// Nest returns an ExtractFunc that extracts the resources of a nested route
+// with extracts, outermost first, and returns them as a *ResourceChain.
+// Extract functions that return a *ResourceChain themselves are flattened,
+// so nested routes can be composed from the extractors of their parents.
+//
+// If verifier is not nil, each resource must be the parent of the next one,
+// and all of them must implement ObjectResource. WrapWith verifies the parent
+// relations after the requirement of the chain is satisfied, and answers with
+// 404 if the addressed resource does not exist below its parent. Requests that
+// lack the permission are denied before, so that they cannot learn the hierarchy.
+func Nest(verifier ParentVerifier, extracts ...ExtractFunc) ExtractFunc {
+	if len(extracts) == 0 {
+		panic("Nest requires at least one ExtractFunc")
+	}
+	return func(r *http.Request, p httprouter.Params) (Resource, error) {
+		chain := &ResourceChain{}
+		for _, extract := range extracts {
+			resource, err := extract(r, p)
+			if err != nil {
+				return nil, err
+			}
+			var next []Resource
+			if inner, ok := resource.(*ResourceChain); ok {
+				next = inner.resources
+				chain.parents = append(chain.parents, inner.parents...)
+			} else {
+				next = []Resource{resource}
+			}
+			if verifier != nil && len(chain.resources) > 0 {
+				chain.parents = append(chain.parents, parentRelation{
+					verifier: verifier,
+					parent:   chain.resources[len(chain.resources)-1],
+					child:    next[0],
+				})
+			}
+			chain.resources = append(chain.resources, next...)
+		}
+		return chain, nil
+	}
+}
+
+// verify verifies the parent relations of the chain. WrapWith calls it once
+// the requirement of the chain is satisfied.
+func (c *ResourceChain) verify(ctx context.Context) error {
+	for _, rel := range c.parents {
+		if err := verifyParent(ctx, rel.verifier, rel.parent, rel.child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyParent returns a 404 *Problem if parent is not the parent of child.
+func verifyParent(ctx context.Context, verifier ParentVerifier, parent, child Resource) error {
+	parentObj, ok := parent.(ObjectResource)
+	if !ok {
+		return fmt.Errorf("verify parent: %T does not implement ObjectResource", parent)
+	}
+	childObj, ok := child.(ObjectResource)
+	if !ok {
+		return fmt.Errorf("verify parent: %T does not implement ObjectResource", child)
+	}
+	parentNs, parentId := parentObj.Object()
+	ns, obj := childObj.Object()
+	ok, err := verifier.HasParent(ctx, ns, obj, parentNs, parentId)
+	if err != nil {
+		return fmt.Errorf("verify parent: %w", err)
+	}
+	if !ok {
+		return NotFound(fmt.Sprintf("%s %s not found in %s %s", ns, obj, parentNs, parentId))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package httprouterext
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// objectResource is an ObjectResource that requires ns.get on itself.
+type objectResource struct {
+	ns  Namespace
+	obj Obj
+}
+
+func (r *objectResource) Requires(string, string) (Namespace, Obj, Permission) {
+	return r.ns, r.obj, Permission(string(r.ns) + ".get")
+}
+
+func (r *objectResource) Object() (Namespace, Obj) {
+	return r.ns, r.obj
+}
+
+func extractObject(ns Namespace, param string) ExtractFunc {
+	return func(_ *http.Request, p httprouter.Params) (Resource, error) {
+		return &objectResource{ns: ns, obj: Obj(p.ByName(param))}, nil
+	}
+}
+
+// testParents is a ParentVerifier of the relations "ns:obj" -> "parentNs:parentObj".
+type testParents struct {
+	parents map[string]string
+	calls   int
+}
+
+func (v *testParents) HasParent(_ context.Context, ns Namespace, obj Obj, parentNs Namespace, parentObj Obj) (bool, error) {
+	v.calls++
+	return v.parents[string(ns)+":"+string(obj)] == string(parentNs)+":"+string(parentObj), nil
+}
+
+func TestNest(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     httprouter.Params
+		granted    Permission
+		wantStatus int
+		wantCalls  int
+	}{
+		{name: "child of parent", params: httprouter.Params{{Key: "pid", Value: "p1"}, {Key: "aid", Value: "a1"}, {Key: "cid", Value: "c1"}}, granted: "comment.get", wantStatus: http.StatusOK, wantCalls: 2},
+		{name: "child of another parent", params: httprouter.Params{{Key: "pid", Value: "p2"}, {Key: "aid", Value: "a1"}, {Key: "cid", Value: "c1"}}, granted: "comment.get", wantStatus: http.StatusNotFound, wantCalls: 1},
+		{name: "inner relation", params: httprouter.Params{{Key: "pid", Value: "p1"}, {Key: "aid", Value: "a1"}, {Key: "cid", Value: "c2"}}, granted: "comment.get", wantStatus: http.StatusNotFound, wantCalls: 2},
+		// Without the permission, both cases are answered alike.
+		{name: "denied child of parent", params: httprouter.Params{{Key: "pid", Value: "p1"}, {Key: "aid", Value: "a1"}, {Key: "cid", Value: "c1"}}, wantStatus: http.StatusForbidden},
+		{name: "denied child of another parent", params: httprouter.Params{{Key: "pid", Value: "p2"}, {Key: "aid", Value: "a1"}, {Key: "cid", Value: "c1"}}, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parents := &testParents{parents: map[string]string{"article:a1": "project:p1", "comment:c1": "article:a1"}}
+			articles := Nest(parents, extractObject("project", "pid"), extractObject("article", "aid"))
+			comments := Nest(parents, articles, extractObject("comment", "cid"))
+			wrapper := &testWrapper{granted: map[Permission]bool{tt.granted: true}}
+			hdl := WrapWith(wrapper, comments, func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params, resource Resource, _ User) error {
+				if chain := resource.(*ResourceChain); len(chain.Resources()) != 3 {
+					t.Errorf("chain of %d resources, want 3", len(chain.Resources()))
+				}
+				w.WriteHeader(http.StatusOK)
+				return nil
+			}, WithAuthenticator(NewHeaderAuthenticator("X-User")))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("X-User", "alice")
+			w := httptest.NewRecorder()
+			hdl(w, r, tt.params)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if parents.calls != tt.wantCalls {
+				t.Errorf("HasParent called %d times, want %d", parents.calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package httprouterext
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// OpenAPI returns an OpenAPI 3.1 document with the paths of the recorded
+// routes and the components they refer to. It is a fragment to be merged into
+// the hand-written spec of a service: operations only describe security, path
+// parameters and the 401 and 403 problem responses, and list the permissions
+// they require in the extension x-permissions. Routes whose template cannot be
+// extracted get x-permissions-error instead, and credentials that OpenAPI
+// cannot describe, those of custom authenticators, are listed in x-auth.
+func (g *RouteRegistry) OpenAPI() map[string]any {
+	paths := make(map[string]map[string]any)
+	schemes := make(map[string]any)
+	for _, rt := range g.all() {
+		info := rt.info()
+		path, params := openAPIPath(info.Path)
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+
+		var security []map[string][]string
+		var custom []string
+		for _, mode := range info.Auth {
+			name, scheme, ok := securityScheme(mode)
+			if !ok {
+				custom = append(custom, mode)
+				continue
+			}
+			schemes[name] = scheme
+			security = append(security, map[string][]string{name: {}})
+		}
+
+		responses := map[string]any{
+			"401": map[string]string{"$ref": "#/components/responses/Unauthorized"},
+		}
+		if len(challengesOf(rt.options.authenticator)) == 0 {
+			responses["303"] = map[string]string{"$ref": "#/components/responses/SignIn"}
+		}
+		op := map[string]any{
+			"responses": responses,
+		}
+		// An empty security list would declare the route public, so routes
+		// that only have custom authenticators rely on x-auth.
+		if len(security) > 0 {
+			op["security"] = security
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if len(custom) > 0 {
+			op["x-auth"] = custom
+		}
+		if !rt.options.authenticateOnly {
+			responses["403"] = map[string]string{"$ref": "#/components/responses/Forbidden"}
+			if resource, err := rt.template(); err != nil {
+				op["x-permissions-error"] = info.Error
+			} else {
+				op["x-permissions"] = openAPIPermissions(resource, rt.method)
+				if info.Permission == "" {
+					op["x-requirement"] = info.Requirement
+				}
+			}
+		}
+		paths[path][strings.ToLower(info.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"paths":   paths,
+		"components": map[string]any{
+			"securitySchemes": schemes,
+			"schemas": map[string]any{
+				"Problem": problemSchema,
+			},
+			"responses": map[string]any{
+				"Unauthorized": problemResponse("Not authenticated, or the credentials are invalid.", map[string]any{
+					"WWW-Authenticate": map[string]any{
+						"description": "The accepted authentication schemes.",
+						"schema":      map[string]string{"type": "string"},
+					},
+				}),
+				"Forbidden": problemResponse("The authenticated principal lacks a required permission.", nil),
+				"SignIn": map[string]any{
+					"description": "Browsers without a session are redirected to the sign-in page.",
+					"headers": map[string]any{
+						"Location": map[string]any{"schema": map[string]string{"type": "string"}},
+					},
+				},
+			},
+		},
+	}
+}
+
+// WriteOpenAPI writes the document of OpenAPI as JSON.
+func (g *RouteRegistry) WriteOpenAPI(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g.OpenAPI())
+}
+
+// openAPIPath converts an httprouter path to an OpenAPI path template and
+// returns its path parameters.
+func openAPIPath(path string) (string, []map[string]any) {
+	var params []map[string]any
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			name := segment[1:]
+			segments[i] = "{" + name + "}"
+			params = append(params, map[string]any{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]string{"type": "string"},
+			})
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// openAPIPermissions returns the permissions resource requires for method as
+// x-permissions entries.
+func openAPIPermissions(resource Resource, method string) []map[string]string {
+	permissions := []map[string]string{}
+	requirementOf(resource, method).walk(func(ns Namespace, obj Obj, permission Permission) {
+		permissions = append(permissions, map[string]string{
+			"namespace":  string(ns),
+			"object":     string(obj),
+			"permission": string(permission),
+		})
+	})
+	return permissions
+}
+
+// securityScheme returns the name and the OpenAPI security scheme of an auth
+// mode of authModes, or false for the modes of custom authenticators.
+func securityScheme(mode string) (string, map[string]any, bool) {
+	kind, name, _ := strings.Cut(mode, ":")
+	switch kind {
+	case "cookie":
+		return "cookie_" + name, map[string]any{"type": "apiKey", "in": "cookie", "name": name}, true
+	case "basic":
+		return "basic", map[string]any{"type": "http", "scheme": "basic"}, true
+	case "bearer":
+		return "bearer", map[string]any{"type": "http", "scheme": "bearer"}, true
+	case "jwt":
+		return "jwt", map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"}, true
+	case "header", "apikey":
+		return "header_" + name, map[string]any{"type": "apiKey", "in": "header", "name": name}, true
+	case "apikey-query":
+		return "query_" + name, map[string]any{"type": "apiKey", "in": "query", "name": name}, true
+	case "mtls":
+		return "mtls", map[string]any{"type": "mutualTLS"}, true
+	default:
+		return "", nil, false
+	}
+}
+
+// problemSchema is the schema of the problem documents written by mapError.
+var problemSchema = map[string]any{
+	"type":     "object",
+	"required": []string{"type", "title", "status"},
+	"properties": map[string]any{
+		"type":     map[string]string{"type": "string"},
+		"title":    map[string]string{"type": "string"},
+		"status":   map[string]string{"type": "integer"},
+		"detail":   map[string]string{"type": "string"},
+		"instance": map[string]string{"type": "string"},
+		"invalid-params": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type":     "object",
+				"required": []string{"name", "reason"},
+				"properties": map[string]any{
+					"name":   map[string]string{"type": "string"},
+					"reason": map[string]string{"type": "string"},
+				},
+			},
+		},
+		"request-id": map[string]string{"type": "string"},
+	},
+}
+
+// problemResponse returns a response with a problem document.
+func problemResponse(description string, headers map[string]any) map[string]any {
+	response := map[string]any{
+		"description": description,
+		"content": map[string]any{
+			"application/problem+json": map[string]any{
+				"schema": map[string]string{"$ref": "#/components/schemas/Problem"},
+			},
+		},
+	}
+	if headers != nil {
+		response["headers"] = headers
+	}
+	return response
+}
@@ -0,0 +1,84 @@
+package httprouterext
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestRouteRegistryOpenAPI(t *testing.T) {
+	registry := NewRouteRegistry()
+	custom := AuthenticatorFunc(func(*http.Request) (Subject, error) {
+		return Subject{}, ErrNoCredentials
+	})
+	WrapWith(&testWrapper{}, extractResource(&testResource{ns: "article", obj: ":id", permission: "article.get"}), okHandler,
+		WithAuthenticator(Chain(NewCookieAuthenticator("session"), custom)),
+		WithRouteRegistry(registry, http.MethodGet, "/articles/:id"))
+	WrapWith(&testWrapper{}, func(*http.Request, httprouter.Params) (Resource, error) {
+		return nil, errors.New("database unavailable")
+	}, okHandler,
+		WithAuthenticator(NewBearerAuthenticator()),
+		WithRouteRegistry(registry, http.MethodDelete, "/articles/:id"))
+	WrapWith(&testWrapper{}, extractResource(&testResource{ns: "article", obj: ":id", permission: "article.update"}), okHandler,
+		WithAuthenticator(custom),
+		WithRouteRegistry(registry, http.MethodPut, "/articles/:id"))
+
+	var b bytes.Buffer
+	if err := registry.WriteOpenAPI(&b); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Paths      map[string]map[string]map[string]any
+		Components struct {
+			SecuritySchemes map[string]map[string]any
+		}
+	}
+	if err := json.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	get := doc.Paths["/articles/{id}"]["get"]
+	wantPermissions := []any{map[string]any{"namespace": "article", "object": ":id", "permission": "article.get"}}
+	if !reflect.DeepEqual(get["x-permissions"], wantPermissions) {
+		t.Errorf("GET x-permissions = %v, want %v", get["x-permissions"], wantPermissions)
+	}
+	if want := []any{map[string]any{"cookie_session": []any{}}}; !reflect.DeepEqual(get["security"], want) {
+		t.Errorf("GET security = %v, want %v", get["security"], want)
+	}
+	if auth, ok := get["x-auth"].([]any); !ok || len(auth) != 1 {
+		t.Errorf("GET x-auth = %v, want the custom authenticator", get["x-auth"])
+	}
+
+	put := doc.Paths["/articles/{id}"]["put"]
+	if security, ok := put["security"]; ok {
+		t.Errorf("PUT security = %v, want no security for a custom authenticator", security)
+	}
+	if auth, ok := put["x-auth"].([]any); !ok || len(auth) != 1 {
+		t.Errorf("PUT x-auth = %v, want the custom authenticator", put["x-auth"])
+	}
+
+	del := doc.Paths["/articles/{id}"]["delete"]
+	if _, ok := del["x-permissions"]; ok {
+		t.Errorf("DELETE x-permissions = %v, want none", del["x-permissions"])
+	}
+	if msg, _ := del["x-permissions-error"].(string); msg != "extract: database unavailable, use WithTemplate" {
+		t.Errorf("DELETE x-permissions-error = %q", msg)
+	}
+
+	for name, scheme := range doc.Components.SecuritySchemes {
+		switch scheme["type"] {
+		case "apiKey", "mutualTLS":
+		case "http":
+			if s := scheme["scheme"]; s != "basic" && s != "bearer" {
+				t.Errorf("security scheme %s: invalid http scheme %v", name, s)
+			}
+		default:
+			t.Errorf("security scheme %s: invalid type %v", name, scheme["type"])
+		}
+	}
+}
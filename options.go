@@ -0,0 +1,173 @@
+package httprouterext
+
+import (
+	"net/http"
+	"time"
+)
+
+// Option configures WrapWith, Router and Observe.
+type Option func(*options)
+
+type options struct {
+	authenticator   Authenticator
+	signIn          SignIn
+	checkTimeout    time.Duration
+	tokenResolver   TokenResolver
+	timestampCookie *TimestampCookie
+	unauthorized    func(w http.ResponseWriter, r *http.Request, err error) error
+	observeAuth     func(r *http.Request, subject Subject, err error)
+	panicHook       func(r *http.Request, recovered any, stack []byte)
+	repanic         bool
+
+	// methodPermissions is checked by Router.Handle.
+	methodPermissions MethodPermissions
+	// template is the resource Router.Validate checks for the route.
+	template Resource
+	// routeMethod and routePath are the route of WrapWith, if known. They
+	// appear in error logs, and registry records the route under them.
+	registry               *RouteRegistry
+	routeMethod, routePath string
+
+	// authenticateOnly allows a nil Wrapper, see BasicAuthenticateOnly.
+	authenticateOnly bool
+}
+
+// newOptions returns the defaults of Wrap with opts applied.
+func newOptions(opts []Option) *options {
+	o := &options{
+		authenticator: NewCookieAuthenticator("session"),
+		signIn:        DefaultSignIn,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithAuthenticator sets the authenticator. The default is a CookieAuthenticator
+// for the cookie "session".
+func WithAuthenticator(auth Authenticator) Option {
+	return func(o *options) {
+		o.authenticator = auth
+	}
+}
+
+// WithSessionCookie authenticates requests by the cookie with the given name.
+func WithSessionCookie(name string) Option {
+	return WithAuthenticator(NewCookieAuthenticator(name))
+}
+
+// WithSignIn sets how requests without valid credentials are answered.
+// The default is DefaultSignIn.
+func WithSignIn(signIn SignIn) Option {
+	return func(o *options) {
+		o.signIn = signIn
+	}
+}
+
+// WithCheckTimeout limits the duration of every permission check.
+// There is no limit by default, apart from the deadline of the request context.
+func WithCheckTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.checkTimeout = d
+	}
+}
+
+// WithTokenResolver resolves the token of an authenticated subject, such as the
+// value of the session cookie, to the principal it was issued to. Permissions are
+// then checked for that principal rather than for the token.
+// Without a resolver, the token is passed to the check service as the user ID.
+func WithTokenResolver(resolver TokenResolver) Option {
+	return func(o *options) {
+		o.tokenResolver = resolver
+	}
+}
+
+// WithTimestampCookie checks permissions at the timestamp carried by a valid
+// check_ts cookie. The check_ts cookie is ignored without this option.
+func WithTimestampCookie(c *TimestampCookie) Option {
+	return func(o *options) {
+		o.timestampCookie = c
+	}
+}
+
+// WithUnauthorized sets how 401 responses are written, for authenticators with
+// challenges such as basic authentication. f is called after the WWW-Authenticate
+// headers have been set, with an error wrapping ErrNoCredentials or ErrInvalidCredentials.
+// f can write a custom body and return nil, or return a *Problem.
+func WithUnauthorized(f func(w http.ResponseWriter, r *http.Request, err error) error) Option {
+	return func(o *options) {
+		o.unauthorized = f
+	}
+}
+
+// WithObserveAuthentication sets the observe function for authentications.
+// The observe function is called after each authentication, with a nil error
+// on success. It can be used to collect metrics about failed authentications.
+func WithObserveAuthentication(f func(r *http.Request, subject Subject, err error)) Option {
+	return func(o *options) {
+		o.observeAuth = f
+	}
+}
+
+// WithPanicHook sets a function that is called with every panic recovered by
+// Observe, for example to report it to an error tracker.
+func WithPanicHook(f func(r *http.Request, recovered any, stack []byte)) Option {
+	return func(o *options) {
+		o.panicHook = f
+	}
+}
+
+// WithRepanic makes Observe re-raise a recovered panic after it has been logged
+// and reported. Tests set it so that a panicking handler fails the test.
+func WithRepanic() Option {
+	return func(o *options) {
+		o.repanic = true
+	}
+}
+
+// withAuthenticateOnly skips the permission check of the route, see BasicAuthenticateOnly.
+func withAuthenticateOnly() Option {
+	return func(o *options) {
+		o.authenticateOnly = true
+	}
+}
+
+// WithMethodPermissions declares the permissions the resources of a route
+// require per method, typically the value their Requires method uses.
+// Router.Handle panics if the method of the route has no mapping.
+func WithMethodPermissions(m MethodPermissions) Option {
+	return func(o *options) {
+		o.methodPermissions = m
+	}
+}
+
+// WithTemplate sets the resource that Router.Handle and Router.Validate check
+// for the route, such as RouteArticleResource. By default, Validate and the
+// exports of the registry extract the template once from the path with every
+// parameter set to its name, e.g. ":id". Routes whose extractor cannot do
+// that, or calls the check service, need a template.
+func WithTemplate(resource Resource) Option {
+	return func(o *options) {
+		o.template = resource
+	}
+}
+
+// withRoute sets the route of WrapWith for its logs, see Router.Handle.
+func withRoute(method, path string) Option {
+	return func(o *options) {
+		o.routeMethod = method
+		o.routePath = path
+	}
+}
+
+// WithRouteRegistry records the handle created by WrapWith in registry as
+// the route for method and path. Routes of a Router are recorded in its
+// registry without this option.
+func WithRouteRegistry(registry *RouteRegistry, method, path string) Option {
+	return func(o *options) {
+		o.registry = registry
+		o.routeMethod = method
+		o.routePath = path
+	}
+}
@@ -0,0 +1,315 @@
+package httprouterext
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// RouteInfo describes how a route is protected.
+type RouteInfo struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Namespace, Object and Permission are those of a route that requires a
+	// single permission. Object is usually a path parameter such as ":id".
+	Namespace  Namespace  `json:"namespace,omitempty"`
+	Object     Obj        `json:"object,omitempty"`
+	Permission Permission `json:"permission,omitempty"`
+	// Requirement is the requirement of the route in the format of the access
+	// log, or "authenticated" for routes without permission check.
+	Requirement string `json:"requirement"`
+	// Auth lists the accepted credentials, e.g. "cookie:session" or "basic".
+	Auth []string `json:"auth"`
+	// Error is set if the resource of the route could not be extracted, see WithTemplate.
+	Error string `json:"error,omitempty"`
+}
+
+// RouteRegistry records routes and the permissions that protect them, for
+// security reviews. A Router records its routes in its registry; handles
+// created with WrapWith are recorded WithRouteRegistry.
+type RouteRegistry struct {
+	mu     sync.Mutex
+	routes []route
+}
+
+// NewRouteRegistry creates an empty registry.
+func NewRouteRegistry() *RouteRegistry {
+	return &RouteRegistry{}
+}
+
+// add records a route.
+func (g *RouteRegistry) add(rt route) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.routes = append(g.routes, rt)
+}
+
+// all returns the recorded routes.
+func (g *RouteRegistry) all() []route {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return slices.Clone(g.routes)
+}
+
+// Routes returns the recorded routes, ordered by path and method.
+func (g *RouteRegistry) Routes() []RouteInfo {
+	routes := g.all()
+	infos := make([]RouteInfo, 0, len(routes))
+	for _, rt := range routes {
+		infos = append(infos, rt.info())
+	}
+	slices.SortStableFunc(infos, func(a, b RouteInfo) int {
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+		return methodOrder(a.Method) - methodOrder(b.Method)
+	})
+	return infos
+}
+
+// info returns the description of the route.
+func (rt *route) info() RouteInfo {
+	info := RouteInfo{
+		Method: rt.method,
+		Path:   rt.path,
+		Auth:   authModes(rt.options.authenticator),
+	}
+	if rt.options.authenticateOnly {
+		info.Requirement = "authenticated"
+		return info
+	}
+	resource, err := rt.template()
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	requirement := requirementOf(resource, rt.method)
+	info.Requirement = requirement.String()
+	if p, ok := requirement.(permissionRequirement); ok {
+		info.Namespace, info.Object, info.Permission = p.ns, p.obj, p.permission
+	}
+	return info
+}
+
+// methodOrder orders the common methods like resourceMethods, others after them.
+func methodOrder(method string) int {
+	if i := slices.Index(resourceMethods, method); i >= 0 {
+		return i
+	}
+	return len(resourceMethods)
+}
+
+// authModes describes the credentials auth accepts.
+func authModes(auth Authenticator) []string {
+	switch auth := auth.(type) {
+	case *ChainAuthenticator:
+		var modes []string
+		for _, a := range auth.authenticators {
+			modes = append(modes, authModes(a)...)
+		}
+		return modes
+	case *CookieAuthenticator:
+		return []string{"cookie:" + auth.name}
+	case *BearerAuthenticator:
+		return []string{"bearer"}
+	case *JWTAuthenticator:
+		return []string{"jwt"}
+	case *HeaderAuthenticator:
+		return []string{"header:" + auth.name}
+	case *BasicAuthenticator:
+		return []string{"basic"}
+	case *APIKeyAuthenticator:
+		modes := []string{"apikey:" + auth.header}
+		if auth.query != "" {
+			modes = append(modes, "apikey-query:"+auth.query)
+		}
+		return modes
+	case *ClientCertAuthenticator:
+		return []string{"mtls"}
+	default:
+		return []string{fmt.Sprintf("%T", auth)}
+	}
+}
+
+// WriteJSON writes the routes as a JSON array.
+func (g *RouteRegistry) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g.Routes())
+}
+
+var csvHeader = []string{"method", "path", "namespace", "object", "permission", "requirement", "auth", "error"}
+
+// WriteCSV writes the routes as CSV with a header line. Several auth modes are separated by spaces.
+func (g *RouteRegistry) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, info := range g.Routes() {
+		record := []string{
+			info.Method,
+			info.Path,
+			string(info.Namespace),
+			string(info.Object),
+			string(info.Permission),
+			info.Requirement,
+			strings.Join(info.Auth, " "),
+			info.Error,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteMarkdown writes the routes as a Markdown table.
+func (g *RouteRegistry) WriteMarkdown(w io.Writer) error {
+	var b bytes.Buffer
+	b.WriteString("| Method | Path | Namespace | Object | Permission | Requirement | Auth |\n")
+	b.WriteString("|---|---|---|---|---|---|---|\n")
+	for _, info := range g.Routes() {
+		requirement := info.Requirement
+		if info.Error != "" {
+			requirement = "error: " + info.Error
+		}
+		cells := []string{
+			info.Method,
+			info.Path,
+			string(info.Namespace),
+			string(info.Object),
+			string(info.Permission),
+			requirement,
+			strings.Join(info.Auth, ", "),
+		}
+		for i, cell := range cells {
+			cells[i] = markdownCell(cell)
+		}
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// markdownCell escapes the characters that would break a table cell.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// write writes the routes in format "json", "csv" or "md".
+func (g *RouteRegistry) write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		return g.WriteJSON(w)
+	case "csv":
+		return g.WriteCSV(w)
+	case "md", "markdown":
+		return g.WriteMarkdown(w)
+	default:
+		return fmt.Errorf("unknown format %q, use json, csv or md", format)
+	}
+}
+
+// CompareGolden compares the routes with the golden file at path, in the
+// format of its extension: .json, .csv or .md. If update is true, the file
+// is written instead. Tests call it with an -update flag, so that a change
+// of permissions shows up as a change of the golden file in code review:
+//
+//	if err := router.Registry().CompareGolden("testdata/routes.md", *update); err != nil {
+//		t.Fatal(err)
+//	}
+func (g *RouteRegistry) CompareGolden(path string, update bool) error {
+	var got bytes.Buffer
+	if err := g.write(&got, strings.TrimPrefix(filepath.Ext(path), ".")); err != nil {
+		return fmt.Errorf("golden file %s: %w", path, err)
+	}
+	if update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("golden file: %w", err)
+		}
+		if err := os.WriteFile(path, got.Bytes(), 0o644); err != nil {
+			return fmt.Errorf("golden file: %w", err)
+		}
+		return nil
+	}
+	want, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("golden file %s does not exist, run with update to create it", path)
+	}
+	if err != nil {
+		return fmt.Errorf("golden file: %w", err)
+	}
+	if bytes.Equal(want, got.Bytes()) {
+		return nil
+	}
+	wantLines := strings.Split(string(want), "\n")
+	gotLines := strings.Split(got.String(), "\n")
+	line := 0
+	for line < len(wantLines) && line < len(gotLines) && wantLines[line] == gotLines[line] {
+		line++
+	}
+	var w, gl string
+	if line < len(wantLines) {
+		w = wantLines[line]
+	}
+	if line < len(gotLines) {
+		gl = gotLines[line]
+	}
+	return fmt.Errorf("routes differ from golden file %s at line %d:\nwant: %s\ngot:  %s\nrun with update to accept the change", path, line+1, w, gl)
+}
+
+// registryResource is the resource of the registry handler.
+type registryResource struct {
+	ns         Namespace
+	obj        Obj
+	permission Permission
+}
+
+func (r *registryResource) Requires(string, string) (Namespace, Obj, Permission) {
+	return r.ns, r.obj, r.permission
+}
+
+// Handler returns a handle that serves the routes to users with permission on
+// obj in ns, e.g. iam.get on root:root. The format is selected by the query
+// parameter format, json (the default), csv or md.
+func (g *RouteRegistry) Handler(wrapper Wrapper, ns Namespace, obj Obj, permission Permission, opts ...Option) httprouter.Handle {
+	resource := &registryResource{ns: ns, obj: obj, permission: permission}
+	extract := func(*http.Request, httprouter.Params) (Resource, error) {
+		return resource, nil
+	}
+	return WrapWith(wrapper, extract, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params, _ Resource, _ User) error {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "json"
+		}
+		var b bytes.Buffer
+		if err := g.write(&b, format); err != nil {
+			return BadRequest(err.Error())
+		}
+		switch format {
+		case "json":
+			w.Header().Set("Content-Type", "application/json")
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		default:
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		}
+		_, err := w.Write(b.Bytes())
+		return err
+	}, opts...)
+}
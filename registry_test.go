@@ -0,0 +1,64 @@
+package httprouterext
+
+import (
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestRouteRegistryGolden(t *testing.T) {
+	router := NewRouter(&testWrapper{}, WithAuthenticator(Chain(
+		NewCookieAuthenticator("session"),
+		NewAPIKeyAuthenticator(NewMemoryAPIKeyStore()).WithQueryParam("api_key"),
+	)))
+	extract := func(r *http.Request, p httprouter.Params) (Resource, error) {
+		return &methodResource{id: p.ByName("id"), permissions: NewMethodPermissions("article")}, nil
+	}
+	router.GET("/articles/:id", extract, okHandler)
+	router.PUT("/articles/:id", extract, okHandler)
+	router.DELETE("/articles/:id", extract, okHandler)
+	router.GET("/articles/:id/history", func(*http.Request, httprouter.Params) (Resource, error) {
+		return nil, io.ErrUnexpectedEOF
+	}, okHandler, WithTemplate(&testResource{ns: "article", obj: ":id", requirement: AnyOf(
+		Require("article", ":id", "article.update"),
+		Require("root", "root", "iam.get"),
+	)}))
+
+	if err := router.Registry().CompareGolden("testdata/routes.md", *update); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRouteRegistryExtractsOnce(t *testing.T) {
+	var calls int
+	router := NewRouter(&testWrapper{granted: map[Permission]bool{"iam.get": true}}, WithAuthenticator(NewHeaderAuthenticator("X-User")))
+	router.GET("/articles/:id", func(r *http.Request, p httprouter.Params) (Resource, error) {
+		calls++
+		return &testResource{ns: "article", obj: Obj(p.ByName("id")), permission: "article.get"}, nil
+	}, okHandler)
+	registry := router.Registry()
+
+	registry.Routes()
+	if err := registry.WriteJSON(io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.WriteMarkdown(io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/routes?format=csv", nil)
+	r.Header.Set("X-User", "alice")
+	w := httptest.NewRecorder()
+	registry.Handler(router.wrapper, "root", "root", "iam.get", WithAuthenticator(NewHeaderAuthenticator("X-User")))(w, r, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if calls != 1 {
+		t.Errorf("extractor called %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,102 @@
+package httprouterext
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// HeaderRequestID is the header that carries the request ID.
+const HeaderRequestID = "X-Request-Id"
+
+// metadataRequestID is the gRPC metadata key the request ID is forwarded with.
+const metadataRequestID = "x-request-id"
+
+// maxRequestIDLength is the maximum length of an accepted incoming request ID.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx that carries the request ID id.
+// Client calls made with the returned context forward the ID to the check service.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// requestWithID returns r with a request ID in its context and echoes the ID on w.
+// An incoming X-Request-Id, or else the trace ID of a W3C traceparent header, is
+// reused. Otherwise a new ID is generated.
+func requestWithID(w http.ResponseWriter, r *http.Request) *http.Request {
+	if _, ok := RequestIDFromContext(r.Context()); ok {
+		return r
+	}
+	id := incomingRequestID(r)
+	if id == "" {
+		id = newRequestID()
+	}
+	w.Header().Set(HeaderRequestID, id)
+	return r.WithContext(WithRequestID(r.Context(), id))
+}
+
+// incomingRequestID returns the request ID supplied by the client, or "" if there
+// is none or it is unsafe to put into logs.
+func incomingRequestID(r *http.Request) string {
+	if id := r.Header.Get(HeaderRequestID); validRequestID(id) {
+		return id
+	}
+	// traceparent: version "-" trace-id "-" parent-id "-" trace-flags
+	parts := strings.Split(r.Header.Get("Traceparent"), "-")
+	if len(parts) == 4 && len(parts[1]) == 32 && isLowerHex(parts[1]) && parts[1] != strings.Repeat("0", 32) {
+		return parts[1]
+	}
+	return ""
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("-_.:/+=", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random request ID.
+func newRequestID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// outgoingContext adds the request ID of ctx, if any, to the outgoing gRPC metadata.
+func outgoingContext(ctx context.Context) context.Context {
+	if id, ok := RequestIDFromContext(ctx); ok {
+		return metadata.AppendToOutgoingContext(ctx, metadataRequestID, id)
+	}
+	return ctx
+}
@@ -0,0 +1,137 @@
+package httprouterext
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	proto "github.com/ecociel/httprouterext/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRequestID(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	tests := []struct {
+		name   string
+		header map[string]string
+		// want is the expected ID, or "" for a generated one.
+		want string
+	}{
+		{name: "none"},
+		{name: "incoming", header: map[string]string{"X-Request-Id": "req-42.a:b/c+d=e_f"}, want: "req-42.a:b/c+d=e_f"},
+		{name: "too long", header: map[string]string{"X-Request-Id": strings.Repeat("a", 129)}},
+		{name: "longest", header: map[string]string{"X-Request-Id": strings.Repeat("a", 128)}, want: strings.Repeat("a", 128)},
+		{name: "space", header: map[string]string{"X-Request-Id": "req 42"}},
+		{name: "log injection", header: map[string]string{"X-Request-Id": "req\rerror=forged"}},
+		{name: "markup", header: map[string]string{"X-Request-Id": "<script>"}},
+		{name: "non-ASCII", header: map[string]string{"X-Request-Id": "anfrage-ü"}},
+		{name: "traceparent", header: map[string]string{"Traceparent": "00-" + traceID + "-00f067aa0ba902b7-01"}, want: traceID},
+		{name: "request ID before traceparent", header: map[string]string{"X-Request-Id": "req-42", "Traceparent": "00-" + traceID + "-00f067aa0ba902b7-01"}, want: "req-42"},
+		{name: "invalid request ID and traceparent", header: map[string]string{"X-Request-Id": "req 42", "Traceparent": "00-" + traceID + "-00f067aa0ba902b7-01"}, want: traceID},
+		{name: "zero trace ID", header: map[string]string{"Traceparent": "00-" + strings.Repeat("0", 32) + "-00f067aa0ba902b7-01"}},
+		{name: "upper-case trace ID", header: map[string]string{"Traceparent": "00-" + strings.ToUpper(traceID) + "-00f067aa0ba902b7-01"}},
+		{name: "short trace ID", header: map[string]string{"Traceparent": "00-4bf92f35-00f067aa0ba902b7-01"}},
+		{name: "malformed traceparent", header: map[string]string{"Traceparent": traceID}},
+	}
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/articles/1", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			var got string
+			ObserveRequest(w, r, func(w http.ResponseWriter, r *http.Request) error {
+				got, _ = RequestIDFromContext(r.Context())
+				return NotFound("no such article")
+			})
+
+			if tt.want != "" && got != tt.want {
+				t.Errorf("request ID = %q, want %q", got, tt.want)
+			}
+			if tt.want == "" && !generated.MatchString(got) {
+				t.Errorf("request ID = %q, want a generated one", got)
+			}
+			if echoed := w.Header().Get(HeaderRequestID); echoed != got {
+				t.Errorf("%s = %q, want %q", HeaderRequestID, echoed, got)
+			}
+			var doc problemDocument
+			if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+				t.Fatal(err)
+			}
+			if doc.RequestID != got {
+				t.Errorf("problem request-id = %q, want %q", doc.RequestID, got)
+			}
+		})
+	}
+}
+
+func TestRequestIDOfContext(t *testing.T) {
+	// An ID already in the context, e.g. of an outer Observe, is kept.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(WithRequestID(r.Context(), "outer"))
+	r.Header.Set(HeaderRequestID, "inner")
+	var got string
+	ObserveRequest(httptest.NewRecorder(), r, func(_ http.ResponseWriter, r *http.Request) error {
+		got, _ = RequestIDFromContext(r.Context())
+		return nil
+	})
+	if got != "outer" {
+		t.Errorf("request ID = %q, want outer", got)
+	}
+}
+
+func TestOutgoingContext(t *testing.T) {
+	ctx := outgoingContext(WithRequestID(context.Background(), "req-42"))
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok || len(md.Get(metadataRequestID)) != 1 || md.Get(metadataRequestID)[0] != "req-42" {
+		t.Errorf("outgoing metadata = %v, want %s: req-42", md, metadataRequestID)
+	}
+
+	if _, ok := metadata.FromOutgoingContext(outgoingContext(context.Background())); ok {
+		t.Error("outgoing metadata set without a request ID")
+	}
+}
+
+// metadataCheckService is a check service that grants everything and records
+// the outgoing metadata of the calls.
+type metadataCheckService struct {
+	proto.CheckServiceClient
+	md metadata.MD
+}
+
+func (s *metadataCheckService) Check(ctx context.Context, in *proto.CheckRequest, _ ...grpc.CallOption) (*proto.CheckResponse, error) {
+	s.md, _ = metadata.FromOutgoingContext(ctx)
+	return &proto.CheckResponse{Ok: true, Principal: &proto.Principal{Id: in.UserId}}, nil
+}
+
+func TestClientForwardsRequestID(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	service := &metadataCheckService{}
+	client := &Client{grpcClient: service}
+	hdl := WrapWith(client, extractResource(&testResource{ns: "article", obj: "1", permission: "article.get"}), okHandler, WithAuthenticator(NewHeaderAuthenticator("X-User")))
+	r := httptest.NewRequest(http.MethodGet, "/articles/1", nil)
+	r.Header.Set("X-User", "alice")
+	r.Header.Set(HeaderRequestID, "req-42")
+	w := httptest.NewRecorder()
+	hdl(w, r, nil)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := service.md.Get(metadataRequestID); len(got) != 1 || got[0] != "req-42" {
+		t.Errorf("check metadata %s = %v, want [req-42]", metadataRequestID, got)
+	}
+}
@@ -0,0 +1,199 @@
+package httprouterext
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"strings"
+)
+
+// Grant is a permission on an object that the check service granted.
+type Grant struct {
+	Ns         Namespace
+	Obj        Obj
+	Permission Permission
+	// Principal is the principal that granted the permission.
+	Principal Principal
+}
+
+// Requirement is a condition over permissions that a request must satisfy.
+// Requirements are built with Require, AllOf and AnyOf.
+type Requirement interface {
+	// String returns the requirement in the format of the access log.
+	String() string
+	evaluate(ctx context.Context, check checkFn, userId UserId) ([]Grant, bool, error)
+	// walk calls f for every permission of the requirement.
+	walk(f func(ns Namespace, obj Obj, permission Permission))
+}
+
+// Requirer is implemented by resources that need more than the single permission
+// returned by Resource.Requires. If a resource implements Requirer, Wrap checks
+// the requirement instead. Requires still provides the namespace and object
+// that User.Can defaults to.
+type Requirer interface {
+	Requirement(principalOrToken string, method string) Requirement
+}
+
+// Require returns the requirement of permission on obj in ns.
+func Require(ns Namespace, obj Obj, permission Permission) Requirement {
+	return permissionRequirement{ns: ns, obj: obj, permission: permission}
+}
+
+// AllOf returns a requirement that is satisfied if all of reqs are satisfied.
+// The requirements are checked concurrently, and the remaining checks are
+// cancelled as soon as one is denied. AllOf without requirements is never
+// satisfied, so that a requirement built from an empty list fails closed.
+func AllOf(reqs ...Requirement) Requirement {
+	return allOf(reqs)
+}
+
+// AnyOf returns a requirement that is satisfied if one of reqs is satisfied.
+// The requirements are checked concurrently, and the remaining checks are
+// cancelled as soon as one is granted. AnyOf without requirements is never satisfied.
+func AnyOf(reqs ...Requirement) Requirement {
+	return anyOf(reqs)
+}
+
+type permissionRequirement struct {
+	ns         Namespace
+	obj        Obj
+	permission Permission
+}
+
+func (p permissionRequirement) String() string {
+	return fmt.Sprintf("%s,%s,%s", p.ns, p.obj, p.permission)
+}
+
+func (p permissionRequirement) evaluate(ctx context.Context, check checkFn, userId UserId) ([]Grant, bool, error) {
+	principal, ok, err := check(ctx, p.ns, p.obj, p.permission, userId)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", p, err)
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	return []Grant{{Ns: p.ns, Obj: p.obj, Permission: p.permission, Principal: principal}}, true, nil
+}
+
+func (p permissionRequirement) walk(f func(ns Namespace, obj Obj, permission Permission)) {
+	f(p.ns, p.obj, p.permission)
+}
+
+type allOf []Requirement
+
+func (reqs allOf) walk(f func(ns Namespace, obj Obj, permission Permission)) {
+	for _, req := range reqs {
+		req.walk(f)
+	}
+}
+
+func (reqs allOf) String() string {
+	return joinRequirements("all-of", reqs)
+}
+
+// evaluate returns the grants of all requirements. A denied requirement takes
+// precedence over a failed check, so that the outcome does not depend on which
+// check finishes first: the error is only returned if no requirement is denied.
+func (reqs allOf) evaluate(ctx context.Context, check checkFn, userId UserId) ([]Grant, bool, error) {
+	switch len(reqs) {
+	case 0:
+		return nil, false, nil
+	case 1:
+		return reqs[0].evaluate(ctx, check, userId)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := evaluateConcurrently(ctx, reqs, check, userId)
+	grants := make([][]Grant, len(reqs))
+	var firstErr error
+	for range reqs {
+		res := <-results
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			continue
+		}
+		if !res.ok {
+			return nil, false, nil
+		}
+		grants[res.index] = res.grants
+	}
+	if firstErr != nil {
+		return nil, false, firstErr
+	}
+	return slices.Concat(grants...), true, nil
+}
+
+type anyOf []Requirement
+
+func (reqs anyOf) walk(f func(ns Namespace, obj Obj, permission Permission)) {
+	for _, req := range reqs {
+		req.walk(f)
+	}
+}
+
+func (reqs anyOf) String() string {
+	return joinRequirements("any-of", reqs)
+}
+
+// evaluate returns the grants of the first satisfied requirement. If none is
+// satisfied but a check failed, the error is returned, because the failed
+// check might have been granted.
+func (reqs anyOf) evaluate(ctx context.Context, check checkFn, userId UserId) ([]Grant, bool, error) {
+	if len(reqs) == 1 {
+		return reqs[0].evaluate(ctx, check, userId)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := evaluateConcurrently(ctx, reqs, check, userId)
+	var firstErr error
+	for range reqs {
+		res := <-results
+		if res.ok {
+			return res.grants, true, nil
+		}
+		if res.err != nil && firstErr == nil {
+			firstErr = res.err
+		}
+	}
+	return nil, false, firstErr
+}
+
+type requirementResult struct {
+	index  int
+	grants []Grant
+	ok     bool
+	err    error
+}
+
+// evaluateConcurrently evaluates each of reqs in its own goroutine. The channel
+// is buffered, so the goroutines finish even if the caller stops receiving.
+// A panic in a check is returned as a *panicError.
+func evaluateConcurrently(ctx context.Context, reqs []Requirement, check checkFn, userId UserId) <-chan requirementResult {
+	results := make(chan requirementResult, len(reqs))
+	for i, req := range reqs {
+		go func() {
+			res := requirementResult{index: i}
+			defer func() {
+				if v := recover(); v != nil {
+					res.err = &panicError{value: v, stack: debug.Stack()}
+				}
+				results <- res
+			}()
+			res.grants, res.ok, res.err = req.evaluate(ctx, check, userId)
+		}()
+	}
+	return results
+}
+
+func joinRequirements(op string, reqs []Requirement) string {
+	parts := make([]string, len(reqs))
+	for i, req := range reqs {
+		parts[i] = req.String()
+	}
+	return op + "(" + strings.Join(parts, "; ") + ")"
+}
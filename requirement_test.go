@@ -0,0 +1,103 @@
+package httprouterext
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testCheck returns a check that grants "granted", denies "denied", fails for
+// "failing" and panics for "panicking", each after the delay of the permission.
+func testCheck(delays map[Permission]time.Duration) checkFn {
+	return func(ctx context.Context, ns Namespace, obj Obj, permission Permission, userId UserId) (Principal, bool, error) {
+		select {
+		case <-time.After(delays[permission]):
+		case <-ctx.Done():
+			return "", false, ctx.Err()
+		}
+		switch permission {
+		case "granted":
+			return Principal(userId), true, nil
+		case "failing":
+			return "", false, errors.New("check service unavailable")
+		case "panicking":
+			panic("check panicked")
+		default:
+			return "", false, nil
+		}
+	}
+}
+
+func TestRequirementEvaluate(t *testing.T) {
+	granted := Require("ns", "obj", "granted")
+	denied := Require("ns", "obj", "denied")
+	failing := Require("ns", "obj", "failing")
+	slow := map[Permission]time.Duration{"denied": 20 * time.Millisecond, "granted": 20 * time.Millisecond}
+
+	tests := []struct {
+		name        string
+		requirement Requirement
+		delays      map[Permission]time.Duration
+		wantOK      bool
+		wantErr     bool
+		wantGrants  int
+	}{
+		{name: "permission", requirement: granted, wantOK: true, wantGrants: 1},
+		{name: "all of", requirement: AllOf(granted, Require("ns", "other", "granted")), wantOK: true, wantGrants: 2},
+		{name: "all of without requirements", requirement: AllOf(), wantOK: false},
+		{name: "all of denied", requirement: AllOf(granted, denied), wantOK: false},
+		{name: "all of denied after a failure", requirement: AllOf(failing, denied), delays: slow, wantOK: false},
+		{name: "all of failed", requirement: AllOf(failing, granted), delays: slow, wantErr: true},
+		{name: "all of panicking", requirement: AllOf(Require("ns", "obj", "panicking"), granted), wantErr: true},
+		{name: "any of", requirement: AnyOf(denied, granted), wantOK: true, wantGrants: 1},
+		{name: "any of without requirements", requirement: AnyOf(), wantOK: false},
+		{name: "any of denied", requirement: AnyOf(denied, denied), wantOK: false},
+		{name: "any of granted after a failure", requirement: AnyOf(failing, granted), delays: slow, wantOK: true, wantGrants: 1},
+		{name: "any of failed", requirement: AnyOf(failing, denied), wantErr: true},
+		{name: "nested", requirement: AllOf(granted, AnyOf(denied, AllOf(granted, granted))), wantOK: true, wantGrants: 3},
+		{name: "nested empty", requirement: AnyOf(AllOf(), denied), wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grants, ok, err := tt.requirement.evaluate(context.Background(), testCheck(tt.delays), "alice")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("evaluate() error = %v, want error %v", err, tt.wantErr)
+			}
+			if ok != tt.wantOK || len(grants) != tt.wantGrants {
+				t.Errorf("evaluate() = %v, %v, want %v with %d grants", grants, ok, tt.wantOK, tt.wantGrants)
+			}
+		})
+	}
+}
+
+func TestRequirementString(t *testing.T) {
+	got := AllOf(Require("a", "1", "a.get"), AnyOf(Require("b", "2", "b.get"), Require("c", "3", "c.get"))).String()
+	want := "all-of(a,1,a.get; any-of(b,2,b.get; c,3,c.get))"
+	if got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+	var permissions []Permission
+	AllOf(Require("a", "1", "a.get"), AnyOf(Require("b", "2", "b.get"))).walk(func(_ Namespace, _ Obj, p Permission) {
+		permissions = append(permissions, p)
+	})
+	if !slices.Equal(permissions, []Permission{"a.get", "b.get"}) {
+		t.Errorf("walk() = %v", permissions)
+	}
+}
+
+func TestWrapEmptyRequirement(t *testing.T) {
+	wrapper := &testWrapper{granted: map[Permission]bool{"article.get": true}}
+	hdl := WrapWith(wrapper, extractResource(&testResource{ns: "article", obj: "1", permission: "article.get", requirement: AllOf()}), okHandler,
+		WithAuthenticator(NewHeaderAuthenticator("X-User")))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-User", "alice")
+	w := httptest.NewRecorder()
+	hdl(w, r, nil)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,120 @@
+package httprouterext
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Router is an httprouter.Router whose routes are protected by WrapWith.
+// The wrapper and options of the router apply to all its routes.
+//
+// The handlers of a Router are registered with a resource extractor and a
+// HandlerFunc. The methods of the embedded httprouter.Router, such as Handler
+// or ServeFiles, remain available for routes that need no authorization.
+type Router struct {
+	*httprouter.Router
+	wrapper  Wrapper
+	options  []Option
+	registry *RouteRegistry
+}
+
+// route is a route registered with Handle or WithRouteRegistry.
+type route struct {
+	method, path string
+	extract      ExtractFunc
+	options      *options
+	// tmpl caches the template, which is extracted on first use.
+	tmpl *routeTemplate
+}
+
+type routeTemplate struct {
+	once     sync.Once
+	resource Resource
+	err      error
+}
+
+// newRoute creates a route. Its template is extracted when exports or
+// Validate first need it, and then never again.
+func newRoute(method, path string, extract ExtractFunc, o *options) route {
+	return route{method: method, path: path, extract: extract, options: o, tmpl: &routeTemplate{}}
+}
+
+// NewRouter creates a router that checks permissions with wrapper.
+func NewRouter(wrapper Wrapper, opts ...Option) *Router {
+	return &Router{
+		Router:   httprouter.New(),
+		wrapper:  wrapper,
+		options:  opts,
+		registry: NewRouteRegistry(),
+	}
+}
+
+// Registry returns the registry of the routes registered with Handle.
+func (r *Router) Registry() *RouteRegistry {
+	return r.registry
+}
+
+// Handle registers hdl for method and path. The options of the route are
+// applied after those of the router.
+//
+// Handle panics if method has no mapping in the MethodPermissions of
+// WithMethodPermissions, or if the template of WithTemplate requires for
+// method no permission, only Impossible, or an empty requirement, because the
+// route would deny every request. Handle does not call extract; Validate
+// reports the routes without a template whose extracted template fails so.
+func (r *Router) Handle(method, path string, extract ExtractFunc, hdl HandlerFunc, opts ...Option) {
+	routeOpts := make([]Option, 0, len(r.options)+len(opts))
+	routeOpts = append(routeOpts, r.options...)
+	routeOpts = append(routeOpts, opts...)
+	rt := newRoute(method, path, extract, newOptions(routeOpts))
+	if m := rt.options.methodPermissions; m != nil {
+		if err := m.Covers(method); err != nil {
+			panic(fmt.Sprintf("route %s %s: %v", method, path, err))
+		}
+	}
+	if rt.options.template != nil {
+		if err := rt.check(); err != nil {
+			panic(fmt.Sprintf("route %s %s: %v", method, path, err))
+		}
+	}
+	r.registry.add(rt)
+	r.Router.Handle(method, path, WrapWith(r.wrapper, extract, hdl, append(routeOpts, withRoute(method, path))...))
+}
+
+// GET is a shortcut for Handle(http.MethodGet, path, extract, hdl, opts...).
+func (r *Router) GET(path string, extract ExtractFunc, hdl HandlerFunc, opts ...Option) {
+	r.Handle(http.MethodGet, path, extract, hdl, opts...)
+}
+
+// HEAD is a shortcut for Handle(http.MethodHead, path, extract, hdl, opts...).
+func (r *Router) HEAD(path string, extract ExtractFunc, hdl HandlerFunc, opts ...Option) {
+	r.Handle(http.MethodHead, path, extract, hdl, opts...)
+}
+
+// OPTIONS is a shortcut for Handle(http.MethodOptions, path, extract, hdl, opts...).
+func (r *Router) OPTIONS(path string, extract ExtractFunc, hdl HandlerFunc, opts ...Option) {
+	r.Handle(http.MethodOptions, path, extract, hdl, opts...)
+}
+
+// POST is a shortcut for Handle(http.MethodPost, path, extract, hdl, opts...).
+func (r *Router) POST(path string, extract ExtractFunc, hdl HandlerFunc, opts ...Option) {
+	r.Handle(http.MethodPost, path, extract, hdl, opts...)
+}
+
+// PUT is a shortcut for Handle(http.MethodPut, path, extract, hdl, opts...).
+func (r *Router) PUT(path string, extract ExtractFunc, hdl HandlerFunc, opts ...Option) {
+	r.Handle(http.MethodPut, path, extract, hdl, opts...)
+}
+
+// PATCH is a shortcut for Handle(http.MethodPatch, path, extract, hdl, opts...).
+func (r *Router) PATCH(path string, extract ExtractFunc, hdl HandlerFunc, opts ...Option) {
+	r.Handle(http.MethodPatch, path, extract, hdl, opts...)
+}
+
+// DELETE is a shortcut for Handle(http.MethodDelete, path, extract, hdl, opts...).
+func (r *Router) DELETE(path string, extract ExtractFunc, hdl HandlerFunc, opts ...Option) {
+	r.Handle(http.MethodDelete, path, extract, hdl, opts...)
+}
@@ -0,0 +1,108 @@
+package httprouterext
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ecociel/httprouterext/schema"
+	"github.com/julienschmidt/httprouter"
+)
+
+// methodResource requires the permission of its method in permissions.
+type methodResource struct {
+	id          string
+	permissions MethodPermissions
+}
+
+func (r *methodResource) Requires(_ string, method string) (Namespace, Obj, Permission) {
+	return "article", Obj(r.id), r.permissions.Permission(method)
+}
+
+func TestRouterHandleChecksRoutes(t *testing.T) {
+	readOnly := MethodPermissions{http.MethodGet: "article.get"}
+	var calls int
+	// parsing fails on the template parameter ":id", like an extractor of numeric IDs.
+	parsing := func(r *http.Request, p httprouter.Params) (Resource, error) {
+		calls++
+		if _, err := strconv.Atoi(p.ByName("id")); err != nil {
+			return nil, err
+		}
+		return &methodResource{id: p.ByName("id"), permissions: readOnly}, nil
+	}
+
+	tests := []struct {
+		name      string
+		method    string
+		opts      []Option
+		wantPanic string
+	}{
+		{name: "no template", method: http.MethodHead},
+		{name: "mapped method", method: http.MethodGet, opts: []Option{WithMethodPermissions(readOnly)}},
+		{name: "unmapped method", method: http.MethodHead, opts: []Option{WithMethodPermissions(readOnly)}, wantPanic: "no permission for method HEAD"},
+		{name: "template", method: http.MethodGet, opts: []Option{WithTemplate(&methodResource{id: ":id", permissions: readOnly})}},
+		{name: "template unmapped", method: http.MethodHead, opts: []Option{WithTemplate(&methodResource{id: ":id", permissions: readOnly})}, wantPanic: "requires impossible"},
+		{name: "template without permission", method: http.MethodGet, opts: []Option{WithTemplate(&testResource{ns: "article", obj: ":id"})}, wantPanic: "maps to no permission"},
+		{name: "template with empty requirement", method: http.MethodGet, opts: []Option{WithTemplate(&testResource{requirement: AllOf()})}, wantPanic: "empty requirement"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				v := recover()
+				msg, _ := v.(string)
+				if tt.wantPanic == "" && v != nil {
+					t.Errorf("Handle() panicked: %v", v)
+				}
+				if tt.wantPanic != "" && !strings.Contains(msg, tt.wantPanic) {
+					t.Errorf("Handle() panic = %v, want %q", v, tt.wantPanic)
+				}
+			}()
+			NewRouter(&testWrapper{}).Handle(tt.method, "/articles/:id", parsing, okHandler, tt.opts...)
+		})
+	}
+	if calls != 0 {
+		t.Errorf("Handle() called the extractor %d times, want 0", calls)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	wrapper := &testWrapper{granted: map[Permission]bool{"article.get": true}}
+	router := NewRouter(wrapper, WithAuthenticator(NewHeaderAuthenticator("X-User")))
+	router.GET("/articles/:id", func(r *http.Request, p httprouter.Params) (Resource, error) {
+		return &methodResource{id: p.ByName("id"), permissions: NewMethodPermissions("article")}, nil
+	}, okHandler)
+
+	r := httptest.NewRequest(http.MethodGet, "/articles/1", nil)
+	r.Header.Set("X-User", "alice")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRouterValidateReportsExtractFailures(t *testing.T) {
+	s, err := schema.Parse([]byte("name: article\nroles:\n  - name: viewer\n    permissions: [article.get]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouter(&testWrapper{})
+	router.GET("/articles/:id", func(r *http.Request, p httprouter.Params) (Resource, error) {
+		if _, err := strconv.Atoi(p.ByName("id")); err != nil {
+			return nil, err
+		}
+		return &testResource{ns: "article", obj: Obj(p.ByName("id")), permission: "article.get"}, nil
+	}, okHandler)
+
+	err = router.Validate(s)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || !strings.Contains(errs[0].Msg, "use WithTemplate") {
+		t.Fatalf("Validate() = %v, want the extract error", err)
+	}
+	if info := router.Registry().Routes()[0]; !strings.Contains(info.Error, "use WithTemplate") {
+		t.Errorf("RouteInfo.Error = %q, want the extract error", info.Error)
+	}
+}
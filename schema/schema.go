@@ -0,0 +1,421 @@
+// Package schema models the namespace configuration of the check service: a
+// multi-document YAML file with one namespace per document.
+//
+//	name: project
+//	roles:
+//	  - name: owner
+//	    inherit: editor
+//	    permissions:
+//	      - project.delete
+//	  - name: editor
+//	    permissions:
+//	      - project.get
+//	      - project.update
+//
+// A role has the permissions it lists and, transitively, those of the roles of
+// the same namespace it inherits. inherit is a role name or a list of role names.
+package schema
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schema is a parsed namespace configuration.
+type Schema struct {
+	Namespaces []*Namespace
+}
+
+// Namespace is a namespace and its roles.
+type Namespace struct {
+	Name  string
+	Roles []*Role
+	// File, Doc and Line locate the namespace in the configuration.
+	File string
+	Doc  int
+	Line int
+}
+
+// Role is a role of a namespace.
+type Role struct {
+	Name        string
+	Inherit     []string
+	Permissions []string
+	Line        int
+
+	effective []string
+}
+
+// Error is an error at a position of the configuration. Doc is the index of
+// the YAML document, starting at 0, and Line the line in the file, starting at 1.
+type Error struct {
+	File string
+	Doc  int
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+		b.WriteString(": ")
+	}
+	fmt.Fprintf(&b, "document %d", e.Doc)
+	if e.Line > 0 {
+		fmt.Fprintf(&b, ", line %d", e.Line)
+	}
+	b.WriteString(": ")
+	b.WriteString(e.Msg)
+	return b.String()
+}
+
+// Errors are all errors found in a configuration.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// RelUnspecified is the role "..." that stands for any relation.
+const RelUnspecified = "..."
+
+// Parse parses a configuration. The error is of type Errors.
+func Parse(data []byte) (*Schema, error) {
+	return parse("", data)
+}
+
+// ParseFiles parses the configuration files at paths into one schema.
+// The error is of type Errors, or that of reading a file.
+func ParseFiles(paths ...string) (*Schema, error) {
+	s := &Schema{}
+	var errs Errors
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		namespaces, fileErrs := parseDocuments(path, data)
+		s.Namespaces = append(s.Namespaces, namespaces...)
+		errs = append(errs, fileErrs...)
+	}
+	return s.validate(errs)
+}
+
+func parse(file string, data []byte) (*Schema, error) {
+	namespaces, errs := parseDocuments(file, data)
+	s := &Schema{Namespaces: namespaces}
+	return s.validate(errs)
+}
+
+// Namespace returns the namespace with the given name.
+func (s *Schema) Namespace(name string) (*Namespace, bool) {
+	for _, ns := range s.Namespaces {
+		if ns.Name == name {
+			return ns, true
+		}
+	}
+	return nil, false
+}
+
+// Role returns the role with the given name.
+func (ns *Namespace) Role(name string) (*Role, bool) {
+	for _, r := range ns.Roles {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// Permissions returns the permissions granted by the roles of the namespace, sorted.
+func (ns *Namespace) Permissions() []string {
+	var permissions []string
+	for _, r := range ns.Roles {
+		permissions = append(permissions, r.effective...)
+	}
+	slices.Sort(permissions)
+	return slices.Compact(permissions)
+}
+
+// Grants reports whether a check of permission on an object of the namespace
+// can succeed, that is whether permission is a role of the namespace or is
+// granted by one.
+func (ns *Namespace) Grants(permission string) bool {
+	if _, ok := ns.Role(permission); ok {
+		return true
+	}
+	for _, r := range ns.Roles {
+		if _, ok := slices.BinarySearch(r.effective, permission); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectivePermissions returns the permissions of the role including those of
+// the roles it inherits, sorted.
+func (r *Role) EffectivePermissions() []string {
+	return r.effective
+}
+
+// parseDocuments parses the documents of a file. Namespaces without a name
+// and roles without a name are skipped, so that the rest can be validated, and
+// so are empty documents.
+func parseDocuments(file string, data []byte) ([]*Namespace, Errors) {
+	var namespaces []*Namespace
+	var errs Errors
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for doc := 0; ; doc++ {
+		var node yaml.Node
+		err := dec.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			return namespaces, errs
+		}
+		if err != nil {
+			// The decoder cannot continue after a syntax error.
+			return namespaces, append(errs, &Error{File: file, Doc: doc, Msg: err.Error()})
+		}
+		if isEmpty(&node) {
+			// E.g. after a trailing "---".
+			continue
+		}
+		p := &parser{file: file, doc: doc}
+		ns := p.namespace(&node)
+		errs = append(errs, p.errs...)
+		if ns != nil && ns.Name != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+}
+
+// isEmpty reports whether doc is an empty or null document.
+func isEmpty(doc *yaml.Node) bool {
+	if len(doc.Content) == 0 {
+		return true
+	}
+	content := doc.Content[0]
+	return content.Kind == yaml.ScalarNode && content.Tag == "!!null"
+}
+
+type parser struct {
+	file string
+	doc  int
+	errs Errors
+}
+
+func (p *parser) errorf(node *yaml.Node, format string, args ...any) {
+	p.errs = append(p.errs, &Error{File: p.file, Doc: p.doc, Line: node.Line, Msg: fmt.Sprintf(format, args...)})
+}
+
+// fields returns the values of a mapping node by key and reports unknown keys.
+func (p *parser) fields(node *yaml.Node, what string, known ...string) map[string]*yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		p.errorf(node, "%s: expected a mapping", what)
+		return nil
+	}
+	fields := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		switch {
+		case !slices.Contains(known, key.Value):
+			p.errorf(key, "%s: unknown field %q", what, key.Value)
+		case fields[key.Value] != nil:
+			p.errorf(key, "%s: duplicate field %q", what, key.Value)
+		default:
+			fields[key.Value] = value
+		}
+	}
+	return fields
+}
+
+func (p *parser) scalar(node *yaml.Node, what string) string {
+	if node.Kind != yaml.ScalarNode || node.Value == "" {
+		p.errorf(node, "%s: expected a non-empty string", what)
+		return ""
+	}
+	return node.Value
+}
+
+func (p *parser) scalars(node *yaml.Node, what string) []string {
+	if node.Kind == yaml.ScalarNode {
+		return []string{p.scalar(node, what)}
+	}
+	if node.Kind != yaml.SequenceNode {
+		p.errorf(node, "%s: expected a string or a list of strings", what)
+		return nil
+	}
+	values := make([]string, 0, len(node.Content))
+	for _, item := range node.Content {
+		values = append(values, p.scalar(item, what))
+	}
+	return values
+}
+
+func (p *parser) namespace(doc *yaml.Node) *Namespace {
+	node := doc.Content[0]
+	ns := &Namespace{File: p.file, Doc: p.doc, Line: node.Line}
+	fields := p.fields(node, "namespace", "name", "roles")
+	if name, ok := fields["name"]; ok {
+		ns.Name = p.scalar(name, "namespace name")
+	} else if node.Kind == yaml.MappingNode {
+		p.errorf(node, "namespace: missing name")
+	}
+
+	roles, ok := fields["roles"]
+	if !ok {
+		return ns
+	}
+	if roles.Kind != yaml.SequenceNode {
+		p.errorf(roles, "namespace %s: roles: expected a list", ns.Name)
+		return ns
+	}
+	for _, item := range roles.Content {
+		what := fmt.Sprintf("namespace %s: role", ns.Name)
+		fields := p.fields(item, what, "name", "inherit", "permissions")
+		r := &Role{Line: item.Line}
+		if name, ok := fields["name"]; ok {
+			r.Name = p.scalar(name, what+" name")
+		} else if item.Kind == yaml.MappingNode {
+			p.errorf(item, "%s: missing name", what)
+		}
+		what = fmt.Sprintf("namespace %s: role %s", ns.Name, r.Name)
+		if inherit, ok := fields["inherit"]; ok {
+			r.Inherit = p.scalars(inherit, what+": inherit")
+		}
+		if permissions, ok := fields["permissions"]; ok {
+			if permissions.Kind != yaml.SequenceNode {
+				p.errorf(permissions, "%s: permissions: expected a list", what)
+			} else {
+				for _, item := range permissions.Content {
+					permission := p.scalar(item, what+": permission")
+					if slices.Contains(r.Permissions, permission) {
+						p.errorf(item, "%s: duplicate permission %q", what, permission)
+					}
+					r.Permissions = append(r.Permissions, permission)
+				}
+			}
+		}
+		if r.Name != "" {
+			ns.Roles = append(ns.Roles, r)
+		}
+	}
+	return ns
+}
+
+// validate checks the references between the parsed namespaces and computes
+// the effective permissions. It returns errs and the errors it finds.
+func (s *Schema) validate(errs Errors) (*Schema, error) {
+	seen := make(map[string]*Namespace)
+	for _, ns := range s.Namespaces {
+		errorf := func(line int, format string, args ...any) {
+			errs = append(errs, &Error{File: ns.File, Doc: ns.Doc, Line: line, Msg: fmt.Sprintf(format, args...)})
+		}
+		if other, dup := seen[ns.Name]; dup {
+			errorf(ns.Line, "duplicate namespace %s, first defined in document %d", ns.Name, other.Doc)
+			continue
+		}
+		seen[ns.Name] = ns
+
+		roles := make(map[string]*Role)
+		for _, r := range ns.Roles {
+			if _, dup := roles[r.Name]; dup {
+				errorf(r.Line, "namespace %s: duplicate role %s", ns.Name, r.Name)
+				continue
+			}
+			roles[r.Name] = r
+		}
+		valid := true
+		for _, r := range ns.Roles {
+			for _, name := range r.Inherit {
+				if _, ok := roles[name]; !ok {
+					errorf(r.Line, "namespace %s: role %s inherits unknown role %s", ns.Name, r.Name, name)
+					valid = false
+				}
+			}
+		}
+		if !valid {
+			continue
+		}
+		done := make(map[string]bool)
+		for _, r := range ns.Roles {
+			if cycle := findCycle(roles, done, r); cycle != nil {
+				errorf(roles[cycle[0]].Line, "namespace %s: inherit cycle %s", ns.Name, strings.Join(cycle, " -> "))
+				valid = false
+				break
+			}
+		}
+		if !valid {
+			continue
+		}
+		for _, r := range ns.Roles {
+			effectivePermissions(roles, r)
+		}
+	}
+	if len(errs) > 0 {
+		slices.SortStableFunc(errs, func(a, b *Error) int {
+			if a.File != b.File {
+				return strings.Compare(a.File, b.File)
+			}
+			if a.Doc != b.Doc {
+				return a.Doc - b.Doc
+			}
+			return a.Line - b.Line
+		})
+		return nil, errs
+	}
+	return s, nil
+}
+
+// findCycle returns the roles of an inherit cycle that is reachable from r,
+// starting and ending with the same role, or nil. Roles in done are known to
+// reach no cycle; findCycle adds the roles it proves so, so that every role is
+// visited once across the calls of a namespace.
+func findCycle(roles map[string]*Role, done map[string]bool, r *Role) []string {
+	var path []string
+	var visit func(r *Role) []string
+	visit = func(r *Role) []string {
+		if done[r.Name] {
+			return nil
+		}
+		if i := slices.Index(path, r.Name); i >= 0 {
+			return append(slices.Clone(path[i:]), r.Name)
+		}
+		path = append(path, r.Name)
+		for _, name := range r.Inherit {
+			if cycle := visit(roles[name]); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		done[r.Name] = true
+		return nil
+	}
+	return visit(r)
+}
+
+// effectivePermissions returns the permissions of r and the roles it inherits
+// and stores them in r.effective. The roles must be free of cycles.
+func effectivePermissions(roles map[string]*Role, r *Role) []string {
+	if r.effective != nil {
+		return r.effective
+	}
+	permissions := append([]string{}, r.Permissions...)
+	for _, name := range r.Inherit {
+		permissions = append(permissions, effectivePermissions(roles, roles[name])...)
+	}
+	slices.Sort(permissions)
+	r.effective = slices.Compact(permissions)
+	return r.effective
+}
@@ -0,0 +1,146 @@
+package schema
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string][]string // role -> effective permissions, in namespace "project"
+		wantErr string
+	}{
+		{
+			name: "inherit",
+			data: `
+name: project
+roles:
+  - name: owner
+    inherit: editor
+    permissions: [project.delete]
+  - name: editor
+    permissions: [project.get, project.update]
+`,
+			want: map[string][]string{
+				"owner":  {"project.delete", "project.get", "project.update"},
+				"editor": {"project.get", "project.update"},
+			},
+		},
+		{
+			name: "trailing document separator",
+			data: "name: project\nroles:\n  - name: viewer\n    permissions: [project.get]\n---\n",
+			want: map[string][]string{"viewer": {"project.get"}},
+		},
+		{
+			name: "empty documents",
+			data: "---\n---\nname: project\n---\n~\n",
+			want: map[string][]string{},
+		},
+		{
+			name: "diamond",
+			data: `
+name: project
+roles:
+  - name: owner
+    inherit: [editor, commenter]
+  - name: editor
+    inherit: viewer
+    permissions: [project.update]
+  - name: commenter
+    inherit: viewer
+    permissions: [project.comment]
+  - name: viewer
+    permissions: [project.get]
+`,
+			want: map[string][]string{
+				"owner":     {"project.comment", "project.get", "project.update"},
+				"editor":    {"project.get", "project.update"},
+				"commenter": {"project.comment", "project.get"},
+				"viewer":    {"project.get"},
+			},
+		},
+		{
+			name: "cycle",
+			data: `
+name: project
+roles:
+  - name: owner
+    inherit: editor
+  - name: editor
+    inherit: viewer
+  - name: viewer
+    inherit: editor
+`,
+			wantErr: "document 0, line 6: namespace project: inherit cycle editor -> viewer -> editor",
+		},
+		{
+			name:    "not a mapping",
+			data:    "name: project\n---\n- project\n",
+			wantErr: "document 1, line 3: namespace: expected a mapping",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse([]byte(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			ns, ok := s.Namespace("project")
+			if !ok {
+				t.Fatal("namespace project not found")
+			}
+			if len(ns.Roles) != len(tt.want) {
+				t.Errorf("%d roles, want %d", len(ns.Roles), len(tt.want))
+			}
+			for name, want := range tt.want {
+				r, ok := ns.Role(name)
+				if !ok {
+					t.Errorf("role %s not found", name)
+					continue
+				}
+				if got := r.EffectivePermissions(); !slices.Equal(got, want) {
+					t.Errorf("role %s: EffectivePermissions() = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestParseDeepDiamonds checks that validation is linear in the roles of a
+// chain of diamonds, which has exponentially many paths.
+func TestParseDeepDiamonds(t *testing.T) {
+	const depth = 40
+	var b strings.Builder
+	b.WriteString("name: project\nroles:\n")
+	for i := 0; i < depth; i++ {
+		fmt.Fprintf(&b, "  - name: r%d\n    inherit: [a%d, b%d]\n", i, i, i)
+		fmt.Fprintf(&b, "  - name: a%d\n    inherit: r%d\n", i, i+1)
+		fmt.Fprintf(&b, "  - name: b%d\n    inherit: r%d\n", i, i+1)
+	}
+	fmt.Fprintf(&b, "  - name: r%d\n    permissions: [project.get]\n", depth)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := Parse([]byte(b.String()))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Parse() did not return within 5s")
+	}
+}
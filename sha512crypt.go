@@ -0,0 +1,158 @@
+package httprouterext
+
+import (
+	"crypto/sha512"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// SHA-512 crypt as specified in https://www.akkadia.org/drepper/SHA-crypt.txt.
+
+const (
+	sha512CryptPrefix        = "$6$"
+	sha512CryptRoundsPrefix  = "rounds="
+	sha512CryptDefaultRounds = 5000
+	sha512CryptMinRounds     = 1000
+	sha512CryptMaxRounds     = 999999999
+	sha512CryptMaxSalt       = 16
+)
+
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// sha512CryptParams are the parameters of a SHA-512 crypt hash.
+type sha512CryptParams struct {
+	salt         string
+	rounds       int
+	customRounds bool
+}
+
+// parseSHA512Crypt parses a hash of the form $6$[rounds=N$]salt$hash.
+func parseSHA512Crypt(hash string) (sha512CryptParams, error) {
+	if !strings.HasPrefix(hash, sha512CryptPrefix) {
+		return sha512CryptParams{}, errors.New("not a SHA-512 crypt hash")
+	}
+	rest := hash[len(sha512CryptPrefix):]
+	params := sha512CryptParams{rounds: sha512CryptDefaultRounds}
+	if strings.HasPrefix(rest, sha512CryptRoundsPrefix) {
+		value, after, ok := strings.Cut(rest[len(sha512CryptRoundsPrefix):], "$")
+		if !ok {
+			return sha512CryptParams{}, errors.New("malformed SHA-512 crypt rounds")
+		}
+		rounds, err := strconv.Atoi(value)
+		if err != nil {
+			return sha512CryptParams{}, errors.New("malformed SHA-512 crypt rounds")
+		}
+		params.rounds = min(max(rounds, sha512CryptMinRounds), sha512CryptMaxRounds)
+		params.customRounds = true
+		rest = after
+	}
+	salt, _, ok := strings.Cut(rest, "$")
+	if !ok {
+		return sha512CryptParams{}, errors.New("malformed SHA-512 crypt hash")
+	}
+	if len(salt) > sha512CryptMaxSalt {
+		salt = salt[:sha512CryptMaxSalt]
+	}
+	params.salt = salt
+	return params, nil
+}
+
+// sha512Crypt returns the SHA-512 crypt hash of password.
+func sha512Crypt(password []byte, params sha512CryptParams) string {
+	salt := []byte(params.salt)
+
+	b := sha512.New()
+	b.Write(password)
+	b.Write(salt)
+	b.Write(password)
+	sumB := b.Sum(nil)
+
+	a := sha512.New()
+	a.Write(password)
+	a.Write(salt)
+	for n := len(password); n > 0; n -= sha512.Size {
+		a.Write(sumB[:min(n, sha512.Size)])
+	}
+	for n := len(password); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			a.Write(sumB)
+		} else {
+			a.Write(password)
+		}
+	}
+	sumA := a.Sum(nil)
+
+	dp := sha512.New()
+	for range len(password) {
+		dp.Write(password)
+	}
+	p := repeatTo(dp.Sum(nil), len(password))
+
+	ds := sha512.New()
+	for range 16 + int(sumA[0]) {
+		ds.Write(salt)
+	}
+	s := repeatTo(ds.Sum(nil), len(salt))
+
+	c := sumA
+	for i := range params.rounds {
+		h := sha512.New()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(nil)
+	}
+
+	var out strings.Builder
+	out.WriteString(sha512CryptPrefix)
+	if params.customRounds {
+		out.WriteString(sha512CryptRoundsPrefix)
+		out.WriteString(strconv.Itoa(params.rounds))
+		out.WriteByte('$')
+	}
+	out.Write(salt)
+	out.WriteByte('$')
+	for i := range 21 {
+		b2, b1, b0 := c[i], c[(i+21)%63], c[(i+42)%63]
+		if i%3 == 1 {
+			b2, b1, b0 = c[(i+21)%63], c[(i+42)%63], c[i]
+		} else if i%3 == 2 {
+			b2, b1, b0 = c[(i+42)%63], c[i], c[(i+21)%63]
+		}
+		writeCryptBase64(&out, b2, b1, b0, 4)
+	}
+	writeCryptBase64(&out, 0, 0, c[63], 2)
+	return out.String()
+}
+
+// repeatTo returns b repeated up to length n.
+func repeatTo(b []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		out = append(out, b[:min(len(b), n-len(out))]...)
+	}
+	return out
+}
+
+// writeCryptBase64 writes n characters of the crypt base64 encoding of three bytes.
+func writeCryptBase64(out *strings.Builder, b2, b1, b0 byte, n int) {
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	for range n {
+		out.WriteByte(cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+}
@@ -0,0 +1,67 @@
+package httprouterext
+
+import "testing"
+
+// The test vectors of https://www.akkadia.org/drepper/SHA-crypt.txt.
+func TestSHA512Crypt(t *testing.T) {
+	tests := []struct {
+		setting  string
+		password string
+		want     string
+	}{
+		{
+			"$6$saltstring",
+			"Hello world!",
+			"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1",
+		},
+		{
+			"$6$rounds=10000$saltstringsaltstring",
+			"Hello world!",
+			"$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+		},
+		{
+			"$6$rounds=5000$toolongsaltstring",
+			"This is just a test",
+			"$6$rounds=5000$toolongsaltstrin$lQ8jolhgVRVhY4b5pZKaysCLi0QBxGoNeKQzQ3glMhwllF7oGDZxUhx1yxdYcz/e1JSbq3y6JMxxl8audkUEm0",
+		},
+		{
+			"$6$rounds=1400$anotherlongsaltstring",
+			"a very much longer text to encrypt.  This one even stretches over morethan one line.",
+			"$6$rounds=1400$anotherlongsalts$POfYwTEok97VWcjxIiSOjiykti.o/pQs.wPvMxQ6Fm7I6IoYN3CmLs66x9t0oSwbtEW7o7UmJEiDwGqd8p4ur1",
+		},
+		{
+			"$6$rounds=77777$short",
+			"we have a short salt string but not a short password",
+			"$6$rounds=77777$short$WuQyW2YR.hBNpjjRhpYD/ifIw05xdfeEyQoMxIXbkvr0gge1a1x3yRULJ5CCaUeOxFmtlcGZelFl5CxtgfiAc0",
+		},
+		{
+			"$6$rounds=123456$asaltof16chars..",
+			"a short string",
+			"$6$rounds=123456$asaltof16chars..$BtCwjqMJGx5hrJhZywWvt0RLE8uZ4oPwcelCjmw2kSYu.Ec6ycULevoBK25fs2xXgMNrCzIMVcgEJAstJeonj1",
+		},
+		{
+			"$6$rounds=10$roundstoolow",
+			"the minimum number is still observed",
+			"$6$rounds=1000$roundstoolow$kUMsbe306n21p9R.FRkW3IGn.S9NPN0x50YhH1xhLsPuWGsUSklZt58jaTfF4ZEQpyUNGc0dqbpBYYBaHHrsX.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.setting, func(t *testing.T) {
+			params, err := parseSHA512Crypt(tt.setting + "$")
+			if err != nil {
+				t.Fatalf("parseSHA512Crypt() error = %v", err)
+			}
+			if got := sha512Crypt([]byte(tt.password), params); got != tt.want {
+				t.Errorf("sha512Crypt() = %s, want %s", got, tt.want)
+			}
+			ok, err := verifyPasswordHash(tt.want, []byte(tt.password))
+			if err != nil || !ok {
+				t.Errorf("verifyPasswordHash() = %v, %v, want true", ok, err)
+			}
+			ok, err = verifyPasswordHash(tt.want, []byte(tt.password+"x"))
+			if err != nil || ok {
+				t.Errorf("verifyPasswordHash() of a wrong password = %v, %v, want false", ok, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package httprouterext
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SignIn configures how Wrap answers requests without valid credentials.
+//
+// Browser navigations are redirected to the sign-in page, with the requested
+// URL in a query parameter. HTMX requests get an HX-Redirect header to the same
+// page. API requests, which accept JSON, are sent by XMLHttpRequest or fetch, or
+// use a method other than GET or HEAD, get a 401 problem with a WWW-Authenticate
+// header, because a redirect would lose their body or confuse their client.
+type SignIn struct {
+	// URL is the sign-in page.
+	URL string
+	// Param is the query parameter of the sign-in page that carries the URL
+	// to return to after sign-in. No URL is passed if Param is empty.
+	Param string
+	// Challenge is the WWW-Authenticate header sent with 401 responses.
+	// It defaults to "Session".
+	Challenge string
+}
+
+// DefaultSignIn is the SignIn used unless WithSignIn is given.
+var DefaultSignIn = SignIn{
+	URL:   "/signin",
+	Param: "back",
+}
+
+// location returns the URL of the sign-in page for r.
+func (s SignIn) location(r *http.Request) string {
+	if s.Param == "" {
+		return s.URL
+	}
+	back, ok := SameOriginPath(r, r.RequestURI)
+	if !ok {
+		back = "/"
+	}
+	sep := "?"
+	if strings.Contains(s.URL, "?") {
+		sep = "&"
+	}
+	return s.URL + sep + url.QueryEscape(s.Param) + "=" + url.QueryEscape(back)
+}
+
+// unauthenticated answers r, which carries no or invalid credentials according to err.
+func (s SignIn) unauthenticated(w http.ResponseWriter, r *http.Request, err error) error {
+	problem := unauthorizedProblem(err)
+
+	switch {
+	case r.Header.Get("HX-Request") == "true":
+		w.Header().Set("HX-Redirect", s.location(r))
+		return problem
+	case isAPIRequest(r):
+		challenge := s.Challenge
+		if challenge == "" {
+			challenge = "Session"
+		}
+		w.Header().Set("WWW-Authenticate", challenge)
+		return problem
+	default:
+		http.Redirect(w, r, s.location(r), http.StatusSeeOther)
+		return nil
+	}
+}
+
+// isAPIRequest reports whether r is not a plain browser navigation.
+func isAPIRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return true
+	}
+	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		return true
+	}
+	if mode := r.Header.Get("Sec-Fetch-Mode"); mode != "" && mode != "navigate" {
+		return true
+	}
+	return acceptsJSON(r)
+}
+
+// acceptsJSON reports whether r accepts a JSON response but not HTML.
+func acceptsJSON(r *http.Request) bool {
+	json := false
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch {
+		case mediaType == "text/html":
+			return false
+		case mediaType == "application/json", strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"):
+			json = true
+		}
+	}
+	return json
+}
+
+// SameOriginPath checks that target refers to the origin of r and returns it
+// as an absolute path with query. Sign-in pages use it to validate the URL to
+// return to before redirecting, to prevent open redirects.
+func SameOriginPath(r *http.Request, target string) (string, bool) {
+	if target == "" || strings.ContainsAny(target, "\\\r\n") {
+		return "", false
+	}
+	u, err := url.Parse(target)
+	if err != nil || u.Opaque != "" || u.User != nil {
+		return "", false
+	}
+	if u.Scheme != "" || u.Host != "" {
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host != r.Host {
+			return "", false
+		}
+	}
+	if !strings.HasPrefix(u.Path, "/") || strings.HasPrefix(u.Path, "//") {
+		return "", false
+	}
+	path := u.EscapedPath()
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return path, true
+}
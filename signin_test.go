@@ -0,0 +1,118 @@
+package httprouterext
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSameOriginPath(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+		wantOK bool
+	}{
+		{target: "/articles/1?page=2", want: "/articles/1?page=2", wantOK: true},
+		{target: "http://example.com/articles", want: "/articles", wantOK: true},
+		{target: "https://example.com/articles?q=a%20b", want: "/articles?q=a%20b", wantOK: true},
+		{target: "/a%20b", want: "/a%20b", wantOK: true},
+		{target: ""},
+		{target: "//evil.com"},
+		{target: "//evil.com/articles"},
+		{target: `/\evil.com`},
+		{target: `\\evil.com`},
+		{target: "https://evil.com/"},
+		{target: "http://other.example.com/"},
+		{target: "http://example.com:8080/"},
+		{target: "/%2F%2Fevil.com"},
+		{target: "javascript:"},
+		{target: "javascript:alert(1)"},
+		{target: "ftp://example.com/"},
+		{target: "http://user@example.com/"},
+		{target: "articles"},
+		{target: "/articles\r\nSet-Cookie: a=b"},
+	}
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/signin", nil)
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			got, ok := SameOriginPath(r, tt.target)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("SameOriginPath(%q) = %q, %v, want %q, %v", tt.target, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSignInUnauthenticated(t *testing.T) {
+	tests := []struct {
+		name           string
+		signIn         SignIn
+		method         string
+		target         string
+		requestURI     string
+		header         map[string]string
+		err            error
+		wantStatus     int
+		wantLocation   string
+		wantHXRedirect string
+		wantChallenge  string
+	}{
+		{name: "navigation", method: http.MethodGet, target: "/articles/1?page=2", wantStatus: http.StatusSeeOther, wantLocation: "/signin?back=%2Farticles%2F1%3Fpage%3D2"},
+		{name: "navigation with Sec-Fetch-Mode", method: http.MethodGet, target: "/articles", header: map[string]string{"Sec-Fetch-Mode": "navigate", "Accept": "text/html,application/json"}, wantStatus: http.StatusSeeOther, wantLocation: "/signin?back=%2Farticles"},
+		{name: "sign-in URL with query", signIn: SignIn{URL: "/signin?lang=de", Param: "next"}, method: http.MethodGet, target: "/articles", wantStatus: http.StatusSeeOther, wantLocation: "/signin?lang=de&next=%2Farticles"},
+		{name: "no param", signIn: SignIn{URL: "/signin"}, method: http.MethodGet, target: "/articles", wantStatus: http.StatusSeeOther, wantLocation: "/signin"},
+		{name: "cross-origin request URI", method: http.MethodGet, target: "/articles", requestURI: "http://evil.com/articles", wantStatus: http.StatusSeeOther, wantLocation: "/signin?back=%2F"},
+		{name: "htmx", method: http.MethodGet, target: "/articles", header: map[string]string{"HX-Request": "true"}, wantStatus: http.StatusUnauthorized, wantHXRedirect: "/signin?back=%2Farticles"},
+		{name: "json", method: http.MethodGet, target: "/articles", header: map[string]string{"Accept": "application/json"}, wantStatus: http.StatusUnauthorized, wantChallenge: "Session"},
+		{name: "problem json", method: http.MethodGet, target: "/articles", header: map[string]string{"Accept": "application/problem+json"}, wantStatus: http.StatusUnauthorized, wantChallenge: "Session"},
+		{name: "html and json", method: http.MethodGet, target: "/articles", header: map[string]string{"Accept": "text/html, application/json"}, wantStatus: http.StatusSeeOther, wantLocation: "/signin?back=%2Farticles"},
+		{name: "fetch", method: http.MethodGet, target: "/articles", header: map[string]string{"Sec-Fetch-Mode": "cors"}, wantStatus: http.StatusUnauthorized, wantChallenge: "Session"},
+		{name: "xhr", method: http.MethodGet, target: "/articles", header: map[string]string{"X-Requested-With": "XMLHttpRequest"}, wantStatus: http.StatusUnauthorized, wantChallenge: "Session"},
+		{name: "post", method: http.MethodPost, target: "/articles", wantStatus: http.StatusUnauthorized, wantChallenge: "Session"},
+		{name: "custom challenge", signIn: SignIn{URL: "/signin", Challenge: `Cookie realm="app"`}, method: http.MethodDelete, target: "/articles/1", wantStatus: http.StatusUnauthorized, wantChallenge: `Cookie realm="app"`},
+		{name: "invalid credentials", method: http.MethodPut, target: "/articles/1", err: invalidCredentials("session expired"), wantStatus: http.StatusUnauthorized, wantChallenge: "Session"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signIn := tt.signIn
+			if signIn.URL == "" {
+				signIn = DefaultSignIn
+			}
+			err := tt.err
+			if err == nil {
+				err = ErrNoCredentials
+			}
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.requestURI != "" {
+				r.RequestURI = tt.requestURI
+			}
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			var status int
+			if problemErr := signIn.unauthenticated(w, r, err); problemErr != nil {
+				var problem *Problem
+				if !errors.As(problemErr, &problem) {
+					t.Fatalf("unauthenticated() = %v, want a *Problem", problemErr)
+				}
+				status = problem.Status()
+			} else {
+				status = w.Code
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+			if got := w.Header().Get("HX-Redirect"); got != tt.wantHXRedirect {
+				t.Errorf("HX-Redirect = %q, want %q", got, tt.wantHXRedirect)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != tt.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.wantChallenge)
+			}
+		})
+	}
+}
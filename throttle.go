@@ -0,0 +1,327 @@
+package httprouterext
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+type clientIPKey struct{}
+
+// WithClientIP returns a copy of ctx that carries the IP address of the client.
+// BasicAuthenticator passes it to the BasicWrapper.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the IP address of the client carried by ctx.
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(string)
+	return ip, ok && ip != ""
+}
+
+// clientIP returns the IP address of the peer of r.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// ProxyClientIP returns a function for BasicAuthenticator.WithClientIPFunc
+// that determines the client IP behind reverse proxies. If the peer of a request
+// is in one of proxies, the addresses of header, such as X-Forwarded-For, are
+// read from right to left and the first one that is not in proxies is the
+// client IP. Requests from other peers, and requests without such an address,
+// get the address of the peer, because their header could be forged.
+func ProxyClientIP(header string, proxies ...netip.Prefix) func(r *http.Request) string {
+	trusted := func(addr netip.Addr) bool {
+		for _, proxy := range proxies {
+			if proxy.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(r *http.Request) string {
+		peer := clientIP(r)
+		addr, err := netip.ParseAddr(peer)
+		if err != nil || !trusted(addr) {
+			return peer
+		}
+		values := r.Header.Values(header)
+		for i := len(values) - 1; i >= 0; i-- {
+			hops := strings.Split(values[i], ",")
+			for j := len(hops) - 1; j >= 0; j-- {
+				addr, err := netip.ParseAddr(strings.TrimSpace(hops[j]))
+				if err != nil {
+					return peer
+				}
+				if !trusted(addr) {
+					return addr.Unmap().String()
+				}
+			}
+		}
+		return peer
+	}
+}
+
+// AttemptStore records authentication attempts per key.
+// Implementations must be safe for concurrent use. A shared store lets
+// several instances of a service enforce common limits.
+type AttemptStore interface {
+	// Attempt records an attempt for key at now and returns the number of
+	// attempts of key including it, unless key is locked: if lock(n) of the n
+	// attempts recorded so far has not passed since the last one, Attempt
+	// records nothing and returns the remaining time. Checking and recording
+	// must be atomic, so that concurrent attempts cannot all pass the check.
+	Attempt(ctx context.Context, key string, now time.Time, lock func(n int) time.Duration) (n int, retryAfter time.Duration, err error)
+	// Forgive takes back an attempt for key that did not fail.
+	Forgive(ctx context.Context, key string) error
+	// Reset forgets the attempts for key.
+	Reset(ctx context.Context, key string) error
+}
+
+// Throttle is a BasicWrapper that protects another BasicWrapper against
+// password guessing. It counts attempts per username and per client IP.
+// An attempt is counted before the password is verified, and taken back
+// unless it fails, so that concurrent attempts cannot exceed the limit.
+// After a number of free attempts, each further failure locks the username or
+// IP for an exponentially growing delay, during which Authenticate returns a
+// 429 *Problem with a Retry-After header.
+//
+// A successful authentication resets the count of the username, not that of the IP.
+// Behind a reverse proxy, the client IP must be determined with
+// BasicAuthenticator.WithClientIPFunc, or else all clients share the IP of the
+// proxy; WithoutClientIP disables the limit per IP.
+type Throttle struct {
+	wrapper        BasicWrapper
+	store          AttemptStore
+	ignoreIP       bool
+	redaction      usernameRedaction
+	freeAttempts   int
+	baseDelay      time.Duration
+	maxDelay       time.Duration
+	observeLockout func(key string, failures int, retryAfter time.Duration)
+	now            func() time.Time
+}
+
+// NewThrottle creates a throttle in front of wrapper that keeps its state in store.
+// By default, 5 attempts are free, and the delay starts at one second and
+// doubles with every failure up to 15 minutes.
+func NewThrottle(wrapper BasicWrapper, store AttemptStore) *Throttle {
+	return &Throttle{
+		wrapper:      wrapper,
+		store:        store,
+		freeAttempts: 5,
+		baseDelay:    time.Second,
+		maxDelay:     15 * time.Minute,
+		now:          time.Now,
+	}
+}
+
+// WithPolicy sets the number of free attempts and the first and the maximum delay.
+func (t *Throttle) WithPolicy(freeAttempts int, baseDelay, maxDelay time.Duration) *Throttle {
+	t.freeAttempts = freeAttempts
+	t.baseDelay = baseDelay
+	t.maxDelay = maxDelay
+	return t
+}
+
+// WithoutClientIP counts failed attempts per username only.
+func (t *Throttle) WithoutClientIP() *Throttle {
+	t.ignoreIP = true
+	return t
+}
+
+// WithRedactedUsernames redacts the usernames of lockouts in logs, errors and
+// the keys passed to the observe function of WithObserveLockout, like
+// BasicAuthenticator.WithRedactedUsernames, which should get the same key.
+func (t *Throttle) WithRedactedUsernames(key []byte) *Throttle {
+	t.redaction = usernameRedaction{enabled: true, key: key}
+	return t
+}
+
+// WithObserveLockout sets the observe function for lockouts.
+// The observe function is called whenever a username ("user:<name>") or client IP
+// ("ip:<addr>") is locked after a failure.
+// It can be used to collect metrics about the lockouts.
+func (t *Throttle) WithObserveLockout(f func(key string, failures int, retryAfter time.Duration)) *Throttle {
+	t.observeLockout = f
+	return t
+}
+
+// Authenticate authenticates a user with a username and password unless the
+// username or the client IP are locked.
+// It returns whether the authentication was successful and an error.
+func (t *Throttle) Authenticate(ctx context.Context, username, password []byte) (bool, error) {
+	keys := []string{"user:" + string(username)}
+	if ip, ok := ClientIPFromContext(ctx); ok && !t.ignoreIP {
+		keys = append(keys, "ip:"+ip)
+	}
+
+	now := t.now()
+	attempts := make([]int, 0, len(keys))
+	for i, key := range keys {
+		n, retryAfter, err := t.store.Attempt(ctx, key, now, t.delay)
+		if err != nil {
+			t.forgive(ctx, keys[:i])
+			return false, fmt.Errorf("throttle %s: %w", t.logged(key), err)
+		}
+		if retryAfter > 0 {
+			t.forgive(ctx, keys[:i])
+			return false, TooManyRequests("too many failed authentications", retryAfter)
+		}
+		attempts = append(attempts, n)
+	}
+
+	ok, err := t.wrapper.Authenticate(ctx, username, password)
+	if err != nil {
+		t.forgive(ctx, keys)
+		return false, err
+	}
+	if ok {
+		t.forgive(ctx, keys[1:])
+		if err := t.store.Reset(ctx, keys[0]); err != nil {
+			return false, fmt.Errorf("throttle %s: %w", t.logged(keys[0]), err)
+		}
+		return true, nil
+	}
+
+	for i, key := range keys {
+		if delay := t.delay(attempts[i]); delay > 0 {
+			logged := t.logged(key)
+			log.Printf("throttle: lock %s after %d failed authentications for %s", logged, attempts[i], delay)
+			if t.observeLockout != nil {
+				t.observeLockout(logged, attempts[i], delay)
+			}
+		}
+	}
+	return false, nil
+}
+
+// forgive takes back the attempts of keys.
+func (t *Throttle) forgive(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := t.store.Forgive(ctx, key); err != nil {
+			log.Printf("throttle: forgive %s: %v", t.logged(key), err)
+		}
+	}
+}
+
+// logged returns key as it may appear in logs.
+func (t *Throttle) logged(key string) string {
+	if username, ok := strings.CutPrefix(key, "user:"); ok {
+		return "user:" + t.redaction.logged(username)
+	}
+	return key
+}
+
+// delay returns how long a key is locked after n failed attempts.
+func (t *Throttle) delay(n int) time.Duration {
+	if n < t.freeAttempts {
+		return 0
+	}
+	delay := t.baseDelay
+	for i := t.freeAttempts; i < n && delay < t.maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, t.maxDelay)
+}
+
+// MemoryAttemptStore is an AttemptStore that keeps a bounded number of keys in memory.
+type MemoryAttemptStore struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order holds the *attempts of entries, the least recently attempted first.
+	order *list.List
+}
+
+type attempts struct {
+	key  string
+	n    int
+	last time.Time
+}
+
+// NewMemoryAttemptStore creates a store of at most size keys. The attempts of a
+// key are forgotten ttl after the last one, so ttl should exceed the maximum
+// delay of the Throttle. When the store is full, the key with the oldest attempt is dropped.
+func NewMemoryAttemptStore(size int, ttl time.Duration) *MemoryAttemptStore {
+	return &MemoryAttemptStore{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Attempt records an attempt for key unless it is locked.
+func (s *MemoryAttemptStore) Attempt(_ context.Context, key string, now time.Time, lock func(n int) time.Duration) (int, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		a := e.Value.(*attempts)
+		if now.Sub(a.last) > s.ttl {
+			a.n = 0
+		}
+		if retryAfter := a.last.Add(lock(a.n)).Sub(now); retryAfter > 0 {
+			return a.n, retryAfter, nil
+		}
+		a.n++
+		a.last = now
+		s.order.MoveToBack(e)
+		return a.n, 0, nil
+	}
+	s.evict(now)
+	s.entries[key] = s.order.PushBack(&attempts{key: key, n: 1, last: now})
+	return 1, 0, nil
+}
+
+// Forgive takes back an attempt for key.
+func (s *MemoryAttemptStore) Forgive(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		a := e.Value.(*attempts)
+		if a.n--; a.n <= 0 {
+			s.order.Remove(e)
+			delete(s.entries, key)
+		}
+	}
+	return nil
+}
+
+// Reset forgets the attempts for key.
+func (s *MemoryAttemptStore) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		s.order.Remove(e)
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// evict removes the least recently attempted keys that are expired, and the
+// least recently attempted key if the store is still full. Every key is removed
+// at most once, so the cost of evict is constant on average.
+func (s *MemoryAttemptStore) evict(now time.Time) {
+	for e := s.order.Front(); e != nil; e = s.order.Front() {
+		a := e.Value.(*attempts)
+		if now.Sub(a.last) <= s.ttl && len(s.entries) < s.size {
+			return
+		}
+		s.order.Remove(e)
+		delete(s.entries, a.key)
+	}
+}
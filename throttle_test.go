@@ -0,0 +1,192 @@
+package httprouterext
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	now := time.Now()
+	throttle := NewThrottle(testBasicWrapper{}, NewMemoryAttemptStore(100, time.Hour)).WithPolicy(2, time.Second, time.Minute)
+	throttle.now = func() time.Time { return now }
+	authenticate := func(ip, username, password string) error {
+		ctx := WithClientIP(context.Background(), ip)
+		ok, err := throttle.Authenticate(ctx, []byte(username), []byte(password))
+		if err == nil && !ok {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+
+	for range 2 {
+		if err := authenticate("192.0.2.1", "alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("free attempt: error = %v, want ErrInvalidCredentials", err)
+		}
+	}
+	var problem *Problem
+	if err := authenticate("192.0.2.1", "alice", "secret"); !errors.As(err, &problem) || problem.Status() != http.StatusTooManyRequests {
+		t.Fatalf("locked username: error = %v, want 429", err)
+	}
+	if err := authenticate("192.0.2.1", "bob", "secret"); !errors.As(err, &problem) {
+		t.Fatalf("locked IP: error = %v, want 429", err)
+	}
+	if err := authenticate("192.0.2.3", "bob", "secret"); err != nil {
+		t.Fatalf("other IP and username: error = %v", err)
+	}
+	now = now.Add(time.Second)
+	if err := authenticate("192.0.2.1", "alice", "secret"); err != nil {
+		t.Fatalf("after the delay: error = %v", err)
+	}
+}
+
+func TestThrottleWithoutClientIP(t *testing.T) {
+	throttle := NewThrottle(testBasicWrapper{}, NewMemoryAttemptStore(100, time.Hour)).WithPolicy(1, time.Minute, time.Minute).WithoutClientIP()
+	ctx := WithClientIP(context.Background(), "192.0.2.1")
+	if _, err := throttle.Authenticate(ctx, []byte("alice"), []byte("wrong")); err != nil {
+		t.Fatal(err)
+	}
+	// All clients behind a proxy share its IP, the lockout of alice must not lock out bob.
+	if ok, err := throttle.Authenticate(ctx, []byte("bob"), []byte("secret")); !ok || err != nil {
+		t.Errorf("Authenticate() = %v, %v, want true", ok, err)
+	}
+}
+
+func TestProxyClientIP(t *testing.T) {
+	clientIP := ProxyClientIP("X-Forwarded-For", netip.MustParsePrefix("10.0.0.0/8"))
+	tests := []struct {
+		name      string
+		peer      string
+		forwarded []string
+		want      string
+	}{
+		{name: "direct", peer: "192.0.2.1:1234", want: "192.0.2.1"},
+		{name: "forged by a client", peer: "192.0.2.1:1234", forwarded: []string{"198.51.100.1"}, want: "192.0.2.1"},
+		{name: "proxy", peer: "10.0.0.1:1234", forwarded: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{name: "proxy chain", peer: "10.0.0.1:1234", forwarded: []string{"203.0.113.9, 198.51.100.1, 10.0.0.2"}, want: "198.51.100.1"},
+		{name: "several headers", peer: "10.0.0.1:1234", forwarded: []string{"203.0.113.9", "198.51.100.1"}, want: "198.51.100.1"},
+		{name: "proxy without header", peer: "10.0.0.1:1234", want: "10.0.0.1"},
+		{name: "malformed", peer: "10.0.0.1:1234", forwarded: []string{"unknown"}, want: "10.0.0.1"},
+		{name: "mapped", peer: "[::ffff:10.0.0.1]:1234", forwarded: []string{"::ffff:198.51.100.1"}, want: "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.peer
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("client IP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// slowBasicWrapper rejects every password after a while and counts the attempts.
+type slowBasicWrapper struct {
+	calls atomic.Int32
+}
+
+func (w *slowBasicWrapper) Authenticate(context.Context, []byte, []byte) (bool, error) {
+	w.calls.Add(1)
+	time.Sleep(10 * time.Millisecond)
+	return false, nil
+}
+
+func TestThrottleConcurrent(t *testing.T) {
+	wrapper := &slowBasicWrapper{}
+	throttle := NewThrottle(wrapper, NewMemoryAttemptStore(100, time.Hour)).WithPolicy(3, time.Minute, time.Hour)
+	ctx := WithClientIP(context.Background(), "192.0.2.1")
+
+	var wg sync.WaitGroup
+	for range 200 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			throttle.Authenticate(ctx, []byte("alice"), []byte("wrong"))
+		}()
+	}
+	wg.Wait()
+	if n := wrapper.calls.Load(); n != 3 {
+		t.Errorf("%d attempts reached the wrapper, want 3", n)
+	}
+}
+
+func TestThrottleForgivesSuccess(t *testing.T) {
+	throttle := NewThrottle(testBasicWrapper{}, NewMemoryAttemptStore(100, time.Hour)).WithPolicy(1, time.Minute, time.Minute)
+	ctx := WithClientIP(context.Background(), "192.0.2.1")
+	// Users behind the same IP who sign in successfully do not lock it.
+	for _, username := range []string{"alice", "bob", "carol"} {
+		if ok, err := throttle.Authenticate(ctx, []byte(username), []byte("secret")); !ok || err != nil {
+			t.Fatalf("Authenticate(%s) = %v, %v, want true", username, ok, err)
+		}
+	}
+}
+
+func TestThrottleRedactedLockout(t *testing.T) {
+	var observed []string
+	throttle := NewThrottle(testBasicWrapper{}, NewMemoryAttemptStore(100, time.Hour)).
+		WithPolicy(0, time.Minute, time.Minute).
+		WithRedactedUsernames([]byte("key")).
+		WithObserveLockout(func(key string, _ int, _ time.Duration) {
+			observed = append(observed, key)
+		})
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	ctx := WithClientIP(context.Background(), "192.0.2.1")
+	throttle.Authenticate(ctx, []byte("alice"), []byte("wrong"))
+	if _, err := throttle.Authenticate(ctx, []byte("alice"), []byte("wrong")); err == nil {
+		t.Fatal("second attempt: want 429")
+	}
+	if strings.Contains(logs.String(), "alice") {
+		t.Errorf("log contains the username: %s", logs.String())
+	}
+	want := []string{"user:" + usernameRedaction{enabled: true, key: []byte("key")}.logged("alice"), "ip:192.0.2.1"}
+	if !slices.Equal(observed, want) {
+		t.Errorf("observed lockouts %v, want %v", observed, want)
+	}
+}
+
+func TestMemoryAttemptStoreEviction(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	noLock := func(int) time.Duration { return 0 }
+	s := NewMemoryAttemptStore(3, time.Minute)
+	for i := range 3 {
+		if _, _, err := s.Attempt(ctx, fmt.Sprint(i), now.Add(time.Duration(i)*time.Second), noLock); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Key 0 is attempted again, so key 1 is the least recently attempted.
+	if n, _, _ := s.Attempt(ctx, "0", now.Add(3*time.Second), noLock); n != 2 {
+		t.Fatalf("Attempt() = %d, want 2", n)
+	}
+	if _, _, err := s.Attempt(ctx, "3", now.Add(4*time.Second), noLock); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.entries["1"]; ok || len(s.entries) != 3 || s.order.Len() != 3 {
+		t.Errorf("keys = %v, want 1 evicted", s.entries)
+	}
+
+	// Expired keys are evicted before the store is full.
+	if _, _, err := s.Attempt(ctx, "4", now.Add(2*time.Minute), noLock); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.entries) != 1 || s.order.Len() != 1 {
+		t.Errorf("keys = %v, want only 4", s.entries)
+	}
+}
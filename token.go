@@ -0,0 +1,88 @@
+package httprouterext
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrUnknownToken is returned by a TokenResolver for tokens that were not issued or have been revoked.
+var ErrUnknownToken = errors.New("unknown token")
+
+// TokenResolver resolves a token to the principal it was issued to.
+// Client implements TokenResolver with the token namespace of the check service.
+type TokenResolver interface {
+	ResolveToken(ctx context.Context, token string) (Principal, error)
+}
+
+// TokenCache is a TokenResolver that caches the principals resolved by another
+// resolver. Only successful resolutions are cached, so a revoked token remains
+// usable for at most the TTL of the cache.
+type TokenCache struct {
+	resolver TokenResolver
+	ttl      time.Duration
+	size     int
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]tokenCacheEntry
+}
+
+type tokenCacheEntry struct {
+	principal Principal
+	expires   time.Time
+}
+
+// NewTokenCache creates a cache of at most size tokens in front of resolver.
+// Tokens are resolved again after ttl.
+func NewTokenCache(resolver TokenResolver, ttl time.Duration, size int) *TokenCache {
+	return &TokenCache{
+		resolver: resolver,
+		ttl:      ttl,
+		size:     size,
+		entries:  make(map[string]tokenCacheEntry),
+		now:      time.Now,
+	}
+}
+
+// ResolveToken returns the cached principal of token or resolves it.
+func (c *TokenCache) ResolveToken(ctx context.Context, token string) (Principal, error) {
+	now := c.now()
+	c.mu.Lock()
+	entry, ok := c.entries[token]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.principal, nil
+	}
+
+	principal, err := c.resolver.ResolveToken(ctx, token)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.size {
+		c.evict(now)
+	}
+	if len(c.entries) < c.size {
+		c.entries[token] = tokenCacheEntry{principal: principal, expires: now.Add(c.ttl)}
+	}
+	return principal, nil
+}
+
+// evict removes expired entries and, if the cache is still full, an arbitrary one.
+func (c *TokenCache) evict(now time.Time) {
+	for token, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, token)
+		}
+	}
+	for token := range c.entries {
+		if len(c.entries) < c.size {
+			break
+		}
+		delete(c.entries, token)
+	}
+}
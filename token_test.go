@@ -0,0 +1,176 @@
+package httprouterext
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// testTokens resolves the tokens of principals and counts the resolutions.
+type testTokens struct {
+	principals map[string]Principal
+	err        error
+	calls      int
+}
+
+func (r *testTokens) ResolveToken(_ context.Context, token string) (Principal, error) {
+	r.calls++
+	if r.err != nil {
+		return "", r.err
+	}
+	principal, ok := r.principals[token]
+	if !ok {
+		return "", ErrUnknownToken
+	}
+	return principal, nil
+}
+
+func TestTokenCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_700_000_000, 0)
+	resolver := &testTokens{principals: map[string]Principal{"t1": "alice", "t2": "bob", "t3": "carol"}}
+	cache := NewTokenCache(resolver, time.Minute, 2)
+	cache.now = func() time.Time { return now }
+	resolve := func(token string) Principal {
+		t.Helper()
+		principal, err := cache.ResolveToken(ctx, token)
+		if err != nil {
+			t.Fatalf("ResolveToken(%s) error = %v", token, err)
+		}
+		return principal
+	}
+
+	if got := resolve("t1"); got != "alice" {
+		t.Fatalf("ResolveToken(t1) = %s, want alice", got)
+	}
+	resolve("t1")
+	if resolver.calls != 1 {
+		t.Errorf("resolver called %d times within the TTL, want 1", resolver.calls)
+	}
+
+	now = now.Add(time.Minute)
+	resolve("t1")
+	if resolver.calls != 2 {
+		t.Errorf("resolver called %d times after the TTL, want 2", resolver.calls)
+	}
+
+	// The cache never holds more than size tokens.
+	now = now.Add(time.Second)
+	resolve("t2")
+	resolve("t3")
+	if len(cache.entries) != 2 {
+		t.Errorf("%d cached tokens, want 2", len(cache.entries))
+	}
+
+	// Expired tokens are evicted first.
+	now = now.Add(time.Minute)
+	resolve("t1")
+	if len(cache.entries) != 1 {
+		t.Errorf("%d cached tokens, want only t1 after the others expired", len(cache.entries))
+	}
+}
+
+func TestTokenCacheErrors(t *testing.T) {
+	ctx := context.Background()
+	unavailable := errors.New("check service unavailable")
+	tests := []struct {
+		name    string
+		err     error
+		token   string
+		wantErr error
+	}{
+		{name: "unknown token", token: "revoked", wantErr: ErrUnknownToken},
+		{name: "resolver error", token: "t1", err: unavailable, wantErr: unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &testTokens{principals: map[string]Principal{"t1": "alice"}, err: tt.err}
+			cache := NewTokenCache(resolver, time.Minute, 10)
+			for range 2 {
+				if _, err := cache.ResolveToken(ctx, tt.token); !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ResolveToken() error = %v, want %v", err, tt.wantErr)
+				}
+			}
+			if resolver.calls != 2 || len(cache.entries) != 0 {
+				t.Errorf("resolver called %d times, %d cached tokens, want errors not cached", resolver.calls, len(cache.entries))
+			}
+		})
+	}
+}
+
+// principalResource records the principal passed to Requires.
+type principalResource struct {
+	principal string
+}
+
+func (r *principalResource) Requires(principal string, _ string) (Namespace, Obj, Permission) {
+	r.principal = principal
+	return "article", "1", "article.get"
+}
+
+func TestWrapResolvesTokens(t *testing.T) {
+	resolver := &testTokens{principals: map[string]Principal{"session-1": "alice"}}
+	tests := []struct {
+		name          string
+		auth          Authenticator
+		credential    func(r *http.Request)
+		wantStatus    int
+		wantPrincipal string
+	}{
+		{name: "cookie", auth: NewCookieAuthenticator("session"), credential: func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: "session", Value: "session-1"})
+		}, wantStatus: http.StatusOK, wantPrincipal: "alice"},
+		{name: "unknown cookie", auth: NewCookieAuthenticator("session"), credential: func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: "session", Value: "revoked"})
+		}, wantStatus: http.StatusSeeOther},
+		{name: "bearer", auth: NewBearerAuthenticator(), credential: func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer session-1")
+		}, wantStatus: http.StatusOK, wantPrincipal: "alice"},
+		{name: "unknown bearer", auth: NewBearerAuthenticator(), credential: func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer revoked")
+		}, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapper := &recordingWrapper{}
+			resource := &principalResource{}
+			var canOnUser UserId
+			hdl := WrapWith(wrapper, extractResource(resource), func(w http.ResponseWriter, r *http.Request, _ httprouter.Params, _ Resource, u User) error {
+				if _, err := u.CanOn(r.Context(), "blog", "7", "blog.get"); err != nil {
+					return err
+				}
+				canOnUser = wrapper.calls[len(wrapper.calls)-1].userId
+				if u.Token() != "session-1" {
+					t.Errorf("Token() = %q, want the token", u.Token())
+				}
+				return nil
+			}, WithAuthenticator(tt.auth), WithTokenResolver(resolver))
+
+			r := httptest.NewRequest(http.MethodGet, "/articles/1", nil)
+			tt.credential(r)
+			w := httptest.NewRecorder()
+			hdl(w, r, nil)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantPrincipal == "" {
+				if len(wrapper.calls) != 0 {
+					t.Errorf("%d checks for an unknown token, want none", len(wrapper.calls))
+				}
+				return
+			}
+			if resource.principal != tt.wantPrincipal {
+				t.Errorf("Requires got %q, want the resolved principal %q", resource.principal, tt.wantPrincipal)
+			}
+			if wrapper.calls[0].userId != UserId(tt.wantPrincipal) || canOnUser != UserId(tt.wantPrincipal) {
+				t.Errorf("checked for %s and %s, want %s", wrapper.calls[0].userId, canOnUser, tt.wantPrincipal)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package httprouterext
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// TypedExtractFunc is an ExtractFunc that returns a resource of type R.
+type TypedExtractFunc[R Resource] func(r *http.Request, p httprouter.Params) (R, error)
+
+// TypedHandlerFunc is a HandlerFunc that receives the resource as type R.
+type TypedHandlerFunc[R Resource] func(w http.ResponseWriter, r *http.Request, p httprouter.Params, resource R, user User) error
+
+// WrapTyped is like WrapWith, but the compiler checks that hdl receives the
+// type of resource that extract returns.
+func WrapTyped[R Resource](wrapper Wrapper, extract TypedExtractFunc[R], hdl TypedHandlerFunc[R], opts ...Option) httprouter.Handle {
+	return WrapWith(wrapper, extract.Untyped(), hdl.Untyped(), opts...)
+}
+
+// HandleTyped registers hdl for method and path on router like Router.Handle,
+// with the resource types checked like WrapTyped.
+func HandleTyped[R Resource](router *Router, method, path string, extract TypedExtractFunc[R], hdl TypedHandlerFunc[R], opts ...Option) {
+	router.Handle(method, path, extract.Untyped(), hdl.Untyped(), opts...)
+}
+
+// Untyped returns extract as an ExtractFunc, e.g. for use with Nest.
+func (extract TypedExtractFunc[R]) Untyped() ExtractFunc {
+	return func(r *http.Request, p httprouter.Params) (Resource, error) {
+		resource, err := extract(r, p)
+		if err != nil {
+			return nil, err
+		}
+		return resource, nil
+	}
+}
+
+// Untyped returns hdl as a HandlerFunc. The resource passed to the HandlerFunc
+// must be of type R, or a *ResourceChain that contains an R; any other resource
+// is answered with 500 Internal Server Error.
+func (hdl TypedHandlerFunc[R]) Untyped() HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params, resource Resource, user User) error {
+		typed, ok := ResourceOf[R](resource)
+		if !ok {
+			// Only possible if an untyped extractor is combined with hdl.
+			var want R
+			return fmt.Errorf("TypedHandlerFunc: resource of type %T, want %T", resource, want)
+		}
+		return hdl(w, r, p, typed, user)
+	}
+}
@@ -0,0 +1,38 @@
+package httprouterext
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestTypedHandlerFuncUntyped(t *testing.T) {
+	hdl := TypedHandlerFunc[*objectResource](func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params, resource *objectResource, _ User) error {
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}).Untyped()
+	parents := &testParents{parents: map[string]string{"article:a1": "project:p1"}}
+	tests := []struct {
+		name       string
+		extract    ExtractFunc
+		wantStatus int
+	}{
+		{name: "typed", extract: extractObject("article", "aid"), wantStatus: http.StatusOK},
+		{name: "chain", extract: Nest(parents, extractObject("project", "pid"), extractObject("article", "aid")), wantStatus: http.StatusOK},
+		{name: "other type", extract: extractResource(&testResource{ns: "article", obj: "a1", permission: "article.get"}), wantStatus: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapper := &testWrapper{granted: map[Permission]bool{"article.get": true}}
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("X-User", "alice")
+			WrapWith(wrapper, tt.extract, hdl, WithAuthenticator(NewHeaderAuthenticator("X-User")))(w, r, httprouter.Params{{Key: "pid", Value: "p1"}, {Key: "aid", Value: "a1"}})
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -2,13 +2,43 @@ package httprouterext
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 )
 
+// ErrNoChecker is returned by the permission checks of a User if the route
+// has no checker configured, see BasicAuthenticateOnly.
+var ErrNoChecker = errors.New("no checker configured")
+
+// User is the authenticated user of a request.
 type User interface {
+	// Principal returns the principal that granted the permission the resource requires.
+	// For compound requirements, it is the principal of the first grant.
 	Principal() string
+	// Grants returns the permissions that satisfied the requirement of the resource.
+	// For AnyOf, these are the grants of the requirement that was satisfied.
+	Grants() []Grant
+	// Subject returns the authenticated principal that permissions are checked for.
+	Subject() Principal
+	// Token returns the token the subject authenticated with, or "" if it used no token.
+	Token() string
+	// Can reports whether the subject has permission on the object of the resource.
+	Can(ctx context.Context, permission Permission) (bool, error)
+	// CanOn reports whether the subject has permission on obj in ns.
+	CanOn(ctx context.Context, ns Namespace, obj Obj, permission Permission) (bool, error)
+	// ListObjs returns the objects in the namespace of the resource on which the subject has permission.
+	ListObjs(ctx context.Context, permission Permission) ([]Obj, error)
+	// ListObjsIn returns the objects in ns on which the subject has permission.
+	ListObjsIn(ctx context.Context, ns Namespace, permission Permission) ([]Obj, error)
+	// HasPermission checks permission [0] on the object of the resource, or
+	// [1] on obj [0] in the namespace of the resource, or [2] on obj [1] in ns [0].
+	//
+	// Deprecated: Use Can or CanOn.
 	HasPermission(args ...string) (bool, error)
+	// List returns the objects in ns on which the subject has permission.
+	//
+	// Deprecated: Use ListObjsIn.
 	List(ns string, permission string) ([]string, error)
 }
 
@@ -16,6 +46,9 @@ type user struct {
 	ns        Namespace
 	obj       Obj
 	principal Principal
+	subject   Principal
+	token     string
+	grants    []Grant
 	ctx       context.Context
 	check     func(ctx context.Context, ns Namespace, obj Obj, permission Permission, userId UserId) (principal Principal, ok bool, err error)
 	list      func(ctx context.Context, ns Namespace, permission Permission, userId UserId) ([]string, error)
@@ -25,42 +58,75 @@ func (u *user) Principal() string {
 	return string(u.principal)
 }
 
-func (u *user) HasPermission(args ...string) (bool, error) {
-	var ns Namespace
-	var obj Obj
-	var permission Permission
+func (u *user) Grants() []Grant {
+	return u.grants
+}
 
-	switch len(args) {
-	case 1:
-		ns = u.ns
-		obj = u.obj
-		permission = Permission(args[0])
-		break
-	case 2:
-		obj = Obj(args[0])
-		permission = Permission(args[1])
-		break
-	case 3:
-		ns = Namespace(args[0])
-		obj = Obj(args[1])
-		permission = Permission(args[2])
-		break
-	default:
-		panic("HasPermission requires 1 or 3 arguments")
+func (u *user) Subject() Principal {
+	return u.subject
+}
+
+func (u *user) Token() string {
+	return u.token
+}
+
+func (u *user) Can(ctx context.Context, permission Permission) (bool, error) {
+	return u.CanOn(ctx, u.ns, u.obj, permission)
+}
+
+func (u *user) CanOn(ctx context.Context, ns Namespace, obj Obj, permission Permission) (bool, error) {
+	log.Printf("user check: %s %s %s", ns, obj, permission)
+	if u.check == nil {
+		return false, fmt.Errorf("user check: %s %s %s: %w", ns, obj, permission, ErrNoChecker)
 	}
-	log.Printf("user check2: %s %s %s", ns, obj, permission)
-	_, ok, err := u.check(u.ctx, ns, obj, permission, UserId(u.principal))
+	_, ok, err := u.check(ctx, ns, obj, permission, UserId(u.subject))
 	if err != nil {
 		return false, fmt.Errorf("user check: %s %s %s: %w", ns, obj, permission, err)
 	}
 	return ok, nil
 }
 
-func (u *user) List(ns string, permission string) ([]string, error) {
+func (u *user) ListObjs(ctx context.Context, permission Permission) ([]Obj, error) {
+	return u.ListObjsIn(ctx, u.ns, permission)
+}
+
+func (u *user) ListObjsIn(ctx context.Context, ns Namespace, permission Permission) ([]Obj, error) {
 	log.Printf("list: %s %s", ns, permission)
-	objs, err := u.list(u.ctx, Namespace(ns), Permission(permission), UserId(u.principal))
+	if u.list == nil {
+		return nil, fmt.Errorf("list: %s %s: %w", ns, permission, ErrNoChecker)
+	}
+	objs, err := u.list(ctx, ns, permission, UserId(u.subject))
 	if err != nil {
 		return nil, fmt.Errorf("list: %s %s: %w", ns, permission, err)
 	}
-	return objs, nil
+	typed := make([]Obj, len(objs))
+	for i, obj := range objs {
+		typed[i] = Obj(obj)
+	}
+	return typed, nil
+}
+
+func (u *user) HasPermission(args ...string) (bool, error) {
+	switch len(args) {
+	case 1:
+		return u.Can(u.ctx, Permission(args[0]))
+	case 2:
+		return u.CanOn(u.ctx, u.ns, Obj(args[0]), Permission(args[1]))
+	case 3:
+		return u.CanOn(u.ctx, Namespace(args[0]), Obj(args[1]), Permission(args[2]))
+	default:
+		panic("HasPermission requires 1, 2 or 3 arguments")
+	}
+}
+
+func (u *user) List(ns string, permission string) ([]string, error) {
+	objs, err := u.ListObjsIn(u.ctx, Namespace(ns), Permission(permission))
+	if err != nil {
+		return nil, err
+	}
+	untyped := make([]string, len(objs))
+	for i, obj := range objs {
+		untyped[i] = string(obj)
+	}
+	return untyped, nil
 }
@@ -0,0 +1,125 @@
+package httprouterext
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// recordingWrapper grants every permission through the principal
+// group:editors and records the calls.
+type recordingWrapper struct {
+	calls []wrapperCall
+}
+
+type wrapperCall struct {
+	ctx        context.Context
+	ns         Namespace
+	obj        Obj
+	permission Permission
+	userId     UserId
+}
+
+func (c *recordingWrapper) Check(ctx context.Context, ns Namespace, obj Obj, permission Permission, userId UserId) (Principal, bool, error) {
+	c.calls = append(c.calls, wrapperCall{ctx: ctx, ns: ns, obj: obj, permission: permission, userId: userId})
+	return "group:editors", permission != "article.delete", nil
+}
+
+func (c *recordingWrapper) CheckWithTimestamp(ctx context.Context, ns Namespace, obj Obj, permission Permission, userId UserId, _ Timestamp) (Principal, bool, error) {
+	return c.Check(ctx, ns, obj, permission, userId)
+}
+
+func (c *recordingWrapper) List(ctx context.Context, ns Namespace, permission Permission, userId UserId) ([]string, error) {
+	c.calls = append(c.calls, wrapperCall{ctx: ctx, ns: ns, permission: permission, userId: userId})
+	return []string{"1", "2"}, nil
+}
+
+type callerKey struct{}
+
+func TestUser(t *testing.T) {
+	type check struct {
+		ns         Namespace
+		obj        Obj
+		permission Permission
+	}
+	tests := []struct {
+		name     string
+		call     func(ctx context.Context, u User) (any, error)
+		want     any
+		wantCall check
+		// deprecated calls use the context of the request instead of ctx.
+		deprecated bool
+	}{
+		{name: "Can", call: func(ctx context.Context, u User) (any, error) { return u.Can(ctx, "article.update") }, want: true, wantCall: check{"article", "42", "article.update"}},
+		{name: "Can denied", call: func(ctx context.Context, u User) (any, error) { return u.Can(ctx, "article.delete") }, want: false, wantCall: check{"article", "42", "article.delete"}},
+		{name: "CanOn", call: func(ctx context.Context, u User) (any, error) { return u.CanOn(ctx, "blog", "7", "blog.get") }, want: true, wantCall: check{"blog", "7", "blog.get"}},
+		{name: "ListObjs", call: func(ctx context.Context, u User) (any, error) { return u.ListObjs(ctx, "article.get") }, want: []Obj{"1", "2"}, wantCall: check{"article", "", "article.get"}},
+		{name: "ListObjsIn", call: func(ctx context.Context, u User) (any, error) { return u.ListObjsIn(ctx, "blog", "blog.get") }, want: []Obj{"1", "2"}, wantCall: check{"blog", "", "blog.get"}},
+		{name: "HasPermission on the resource", call: func(_ context.Context, u User) (any, error) { return u.HasPermission("article.update") }, want: true, wantCall: check{"article", "42", "article.update"}, deprecated: true},
+		{name: "HasPermission on an object of the namespace", call: func(_ context.Context, u User) (any, error) { return u.HasPermission("43", "article.update") }, want: true, wantCall: check{"article", "43", "article.update"}, deprecated: true},
+		{name: "HasPermission in a namespace", call: func(_ context.Context, u User) (any, error) { return u.HasPermission("blog", "7", "blog.get") }, want: true, wantCall: check{"blog", "7", "blog.get"}, deprecated: true},
+		{name: "List", call: func(_ context.Context, u User) (any, error) { return u.List("blog", "blog.get") }, want: []string{"1", "2"}, wantCall: check{"blog", "", "blog.get"}, deprecated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapper := &recordingWrapper{}
+			var requestCtx context.Context
+			hdl := WrapWith(wrapper, extractResource(&testResource{ns: "article", obj: "42", permission: "article.get"}), func(w http.ResponseWriter, r *http.Request, _ httprouter.Params, _ Resource, u User) error {
+				if u.Subject() != "alice" || u.Principal() != "group:editors" {
+					t.Errorf("Subject() = %s, Principal() = %s, want alice and group:editors", u.Subject(), u.Principal())
+				}
+				requestCtx = r.Context()
+				got, err := tt.call(context.WithValue(r.Context(), callerKey{}, "caller"), u)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("result = %v, want %v", got, tt.want)
+				}
+				return nil
+			}, WithAuthenticator(NewHeaderAuthenticator("X-User")))
+
+			r := httptest.NewRequest(http.MethodGet, "/articles/42", nil)
+			r.Header.Set("X-User", "alice")
+			hdl(httptest.NewRecorder(), r, nil)
+
+			// The first call is the permission check of the route.
+			if len(wrapper.calls) != 2 {
+				t.Fatalf("%d wrapper calls, want 2", len(wrapper.calls))
+			}
+			call := wrapper.calls[1]
+			if got := (check{call.ns, call.obj, call.permission}); got != tt.wantCall {
+				t.Errorf("checked %v, want %v", got, tt.wantCall)
+			}
+			// Checks are made for the subject, not for the principal that granted access.
+			if call.userId != "alice" {
+				t.Errorf("checked for %s, want the subject alice", call.userId)
+			}
+			if tt.deprecated {
+				if call.ctx != requestCtx {
+					t.Error("deprecated call did not use the context of the request")
+				}
+			} else if call.ctx.Value(callerKey{}) != "caller" {
+				t.Error("call did not use the context of the caller")
+			}
+		})
+	}
+}
+
+func TestUserWithoutChecker(t *testing.T) {
+	u := &user{ns: "article", obj: "42", subject: "alice", ctx: context.Background()}
+	if _, err := u.Can(context.Background(), "article.get"); !errors.Is(err, ErrNoChecker) {
+		t.Errorf("Can() error = %v, want ErrNoChecker", err)
+	}
+	if _, err := u.ListObjs(context.Background(), "article.get"); !errors.Is(err, ErrNoChecker) {
+		t.Errorf("ListObjs() error = %v, want ErrNoChecker", err)
+	}
+	if len(u.Grants()) != 0 {
+		t.Errorf("Grants() = %v, want none", u.Grants())
+	}
+}
@@ -0,0 +1,221 @@
+package httprouterext
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ecociel/httprouterext/schema"
+	"github.com/julienschmidt/httprouter"
+)
+
+// resourceMethods are the methods ValidateResources checks.
+var resourceMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+// ValidationError is a permission of a route or resource that no check can grant.
+type ValidationError struct {
+	// Route is the method and path of the route, or "" for ValidateResources.
+	Route string
+	// Resource is the type of the resource, or "" if it could not be extracted.
+	Resource string
+	Method   string
+	Msg      string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Route != "" && e.Resource != "" {
+		return fmt.Sprintf("%s (%s): %s", e.Route, e.Resource, e.Msg)
+	}
+	if e.Route != "" {
+		return fmt.Sprintf("%s: %s", e.Route, e.Msg)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Resource, e.Method, e.Msg)
+}
+
+// ValidationErrors is the report of Router.Validate and ValidateResources.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// ValidateResources checks the permissions that resources, typically route
+// templates such as RouteArticleResource, require for every method against s.
+// It reports unknown namespaces and permissions, and methods that map to no
+// permission. Methods that require Impossible are not reported.
+// The error is of type ValidationErrors.
+func ValidateResources(s *schema.Schema, resources ...Resource) error {
+	var errs ValidationErrors
+	for _, resource := range resources {
+		for _, method := range resourceMethods {
+			for _, msg := range validateResource(s, resource, method) {
+				errs = append(errs, &ValidationError{Resource: fmt.Sprintf("%T", resource), Method: method, Msg: msg})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Validate checks the permissions that the routes of the router require
+// against s, see ValidateResources. Unlike ValidateResources, it also reports
+// routes whose template cannot be extracted, and routes that require
+// Impossible or an empty AllOf or AnyOf, because they deny every request.
+// Validate should be called at startup, after all routes are registered.
+// The error is of type ValidationErrors.
+func (r *Router) Validate(s *schema.Schema) error {
+	var errs ValidationErrors
+	for _, rt := range r.registry.all() {
+		name := rt.method + " " + rt.path
+		resource, err := rt.template()
+		if err != nil {
+			errs = append(errs, &ValidationError{Route: name, Method: rt.method, Msg: err.Error()})
+			continue
+		}
+		msgs := validateResource(s, resource, rt.method)
+		if requiresImpossible(resource, rt.method) {
+			msgs = append(msgs, "requires impossible, every request is denied")
+		}
+		if requiresNothing(resource, rt.method) {
+			msgs = append(msgs, "empty requirement, every request is denied")
+		}
+		for _, msg := range msgs {
+			errs = append(errs, &ValidationError{Route: name, Resource: fmt.Sprintf("%T", resource), Method: rt.method, Msg: msg})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// template returns the template of the route, extracted on first use.
+func (rt *route) template() (Resource, error) {
+	rt.tmpl.once.Do(func() {
+		rt.tmpl.resource, rt.tmpl.err = rt.extractTemplate()
+	})
+	return rt.tmpl.resource, rt.tmpl.err
+}
+
+// extractTemplate returns the resource of WithTemplate, or extracts it from a
+// request for the path with every parameter set to its name.
+func (rt *route) extractTemplate() (resource Resource, err error) {
+	if rt.options.template != nil {
+		return rt.options.template, nil
+	}
+	if rt.extract == nil {
+		return nil, fmt.Errorf("no extractor, use WithTemplate")
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("extract: panic: %v, use WithTemplate", v)
+		}
+	}()
+	req, err := http.NewRequest(rt.method, rt.path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("extract: %w, use WithTemplate", err)
+	}
+	resource, err = rt.extract(req, pathParams(rt.path))
+	if err != nil {
+		return nil, fmt.Errorf("extract: %w, use WithTemplate", err)
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("extract: no resource, use WithTemplate")
+	}
+	return resource, nil
+}
+
+// check returns an error if the template of the route cannot be extracted or
+// denies every request. Handle calls it for routes WithTemplate.
+func (rt *route) check() error {
+	resource, err := rt.template()
+	if err != nil {
+		return err
+	}
+	if requiresNothing(resource, rt.method) {
+		return fmt.Errorf("%T: empty requirement, every request is denied", resource)
+	}
+	if requiresImpossible(resource, rt.method) {
+		return fmt.Errorf("%T: requires impossible, every request is denied", resource)
+	}
+	var unmapped bool
+	requirementOf(resource, rt.method).walk(func(_ Namespace, _ Obj, permission Permission) {
+		unmapped = unmapped || permission == ""
+	})
+	if unmapped {
+		return fmt.Errorf("%T: maps to no permission", resource)
+	}
+	return nil
+}
+
+// pathParams returns the parameters of an httprouter path, each set to its
+// name including the leading ':' or '*'.
+func pathParams(path string) httprouter.Params {
+	var params httprouter.Params
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			params = append(params, httprouter.Param{Key: segment[1:], Value: segment})
+		}
+	}
+	return params
+}
+
+// requirementOf returns the requirement resource has for method, as WrapWith checks it.
+func requirementOf(resource Resource, method string) Requirement {
+	if requirer, ok := resource.(Requirer); ok {
+		return requirer.Requirement("", method)
+	}
+	return Require(resource.Requires("", method))
+}
+
+// validateResource returns the problems of the permissions resource requires for method.
+func validateResource(s *schema.Schema, resource Resource, method string) []string {
+	var msgs []string
+	requirementOf(resource, method).walk(func(ns Namespace, obj Obj, permission Permission) {
+		switch {
+		case permission == "":
+			msgs = append(msgs, "maps to no permission")
+		case permission == Impossible:
+		default:
+			namespace, ok := s.Namespace(string(ns))
+			if !ok {
+				msgs = append(msgs, fmt.Sprintf("unknown namespace %q", ns))
+			} else if !namespace.Grants(string(permission)) {
+				msgs = append(msgs, fmt.Sprintf("namespace %s grants no permission %q", ns, permission))
+			}
+		}
+	})
+	return msgs
+}
+
+// requiresImpossible reports whether resource requires nothing but Impossible for method.
+func requiresImpossible(resource Resource, method string) bool {
+	var permissions []Permission
+	requirementOf(resource, method).walk(func(_ Namespace, _ Obj, permission Permission) {
+		permissions = append(permissions, permission)
+	})
+	return len(permissions) == 1 && permissions[0] == Impossible
+}
+
+// requiresNothing reports whether the requirement of resource for method has no
+// permission, such as an empty AllOf.
+func requiresNothing(resource Resource, method string) bool {
+	empty := true
+	requirementOf(resource, method).walk(func(Namespace, Obj, Permission) {
+		empty = false
+	})
+	return empty
+}
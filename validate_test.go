@@ -0,0 +1,105 @@
+package httprouterext
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/ecociel/httprouterext/schema"
+	"github.com/julienschmidt/httprouter"
+)
+
+func loadTestSchema(t *testing.T) *schema.Schema {
+	t.Helper()
+	s, err := schema.ParseFiles("testdata/namespaces.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// validationMessages returns the messages of the ValidationErrors err.
+func validationMessages(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("error = %v, want ValidationErrors", err)
+	}
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return msgs
+}
+
+func TestValidateResources(t *testing.T) {
+	s := loadTestSchema(t)
+	tests := []struct {
+		name     string
+		resource Resource
+		want     []string
+	}{
+		{name: "valid", resource: &methodResource{permissions: NewMethodPermissions("article")}},
+		{name: "role as permission", resource: &methodResource{permissions: MethodPermissions{http.MethodGet: "viewer"}}},
+		{name: "unknown namespace", resource: &testResource{ns: "blog", obj: "1", requirement: Require("blog", "1", "blog.get")}, want: repeat("*httprouterext.testResource %s: unknown namespace \"blog\"")},
+		{name: "unknown permission", resource: &methodResource{permissions: MethodPermissions{http.MethodGet: "article.get", http.MethodPost: "article.publish"}}, want: []string{
+			`*httprouterext.methodResource POST: namespace article grants no permission "article.publish"`,
+		}},
+		{name: "empty permission", resource: &testResource{ns: "article", obj: "1", requirement: AnyOf(Require("article", "1", "article.get"), Require("article", "1", ""))}, want: repeat("*httprouterext.testResource %s: maps to no permission")},
+		{name: "impossible", resource: &methodResource{permissions: MethodPermissions{}}},
+		{name: "all of", resource: &testResource{requirement: AllOf(Require("article", "1", "article.get"), Require("root", "root", "iam.delete"))}, want: repeat(`*httprouterext.testResource %s: namespace root grants no permission "iam.delete"`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := validationMessages(t, ValidateResources(s, tt.resource))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ValidateResources() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+// repeat formats format with every method of resourceMethods.
+func repeat(format string) []string {
+	var msgs []string
+	for _, method := range resourceMethods {
+		msgs = append(msgs, fmt.Sprintf(format, method))
+	}
+	return msgs
+}
+
+func TestRouterValidate(t *testing.T) {
+	s := loadTestSchema(t)
+	extract := func(resource Resource) ExtractFunc {
+		return func(*http.Request, httprouter.Params) (Resource, error) {
+			return resource, nil
+		}
+	}
+	router := NewRouter(&testWrapper{})
+	router.GET("/articles/:id", extract(&methodResource{permissions: NewMethodPermissions("article")}), okHandler)
+	router.POST("/articles/:id/publish", extract(&methodResource{permissions: MethodPermissions{http.MethodPost: "article.publish"}}), okHandler)
+	router.GET("/blogs/:id", extract(&testResource{ns: "blog", permission: "blog.get"}), okHandler)
+	router.GET("/articles/:id/raw", extract(&testResource{ns: "article"}), okHandler)
+	router.PATCH("/articles/:id", extract(&methodResource{permissions: MethodPermissions{}}), okHandler)
+	router.DELETE("/articles/:id", extract(&testResource{requirement: AnyOf()}), okHandler)
+	router.GET("/articles/:id/history", func(*http.Request, httprouter.Params) (Resource, error) {
+		return nil, errors.New("no history store")
+	}, okHandler)
+
+	want := []string{
+		`POST /articles/:id/publish (*httprouterext.methodResource): namespace article grants no permission "article.publish"`,
+		`GET /blogs/:id (*httprouterext.testResource): unknown namespace "blog"`,
+		`GET /articles/:id/raw (*httprouterext.testResource): maps to no permission`,
+		`PATCH /articles/:id (*httprouterext.methodResource): requires impossible, every request is denied`,
+		`DELETE /articles/:id (*httprouterext.testResource): empty requirement, every request is denied`,
+		`GET /articles/:id/history: extract: no history store, use WithTemplate`,
+	}
+	if got := validationMessages(t, router.Validate(s)); !slices.Equal(got, want) {
+		t.Errorf("Validate() =\n%q\nwant\n%q", got, want)
+	}
+}
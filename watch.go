@@ -0,0 +1,78 @@
+package httprouterext
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// watchedFile is a file that is reloaded when it changes, such as the file of
+// HtpasswdFile and JWKSFile. A change is detected by the modification time or
+// the size of the file, since writes within the resolution of the modification
+// time of the file system leave it unchanged.
+type watchedFile struct {
+	path          string
+	checkInterval time.Duration
+
+	mu        sync.Mutex
+	modTime   time.Time
+	size      int64
+	lastCheck time.Time
+
+	// reloadMu serializes loads, so that concurrent requests do not load
+	// the file at the same time.
+	reloadMu sync.Mutex
+}
+
+// reload reads the file and passes its content to load. The file is recorded
+// as loaded only if load succeeds.
+func (w *watchedFile) reload(load func(data []byte) error) error {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+	return w.read(load)
+}
+
+// reloadIfChanged reloads the file like reload if its modification time or size
+// has changed since it was last loaded. The file is checked at most once per
+// check interval, and not at all while another request checks or loads it.
+func (w *watchedFile) reloadIfChanged(load func(data []byte) error) error {
+	now := time.Now()
+	w.mu.Lock()
+	due := now.Sub(w.lastCheck) >= w.checkInterval
+	w.mu.Unlock()
+	if !due || !w.reloadMu.TryLock() {
+		return nil
+	}
+	defer w.reloadMu.Unlock()
+
+	info, err := os.Stat(w.path)
+	w.mu.Lock()
+	w.lastCheck = now
+	changed := err == nil && (!info.ModTime().Equal(w.modTime) || info.Size() != w.size)
+	w.mu.Unlock()
+	if err != nil || !changed {
+		return err
+	}
+	return w.read(load)
+}
+
+// read reads the file with reloadMu held.
+func (w *watchedFile) read(load func(data []byte) error) error {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return err
+	}
+	if err := load(data); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+	w.lastCheck = time.Now()
+	return nil
+}
@@ -0,0 +1,59 @@
+package httprouterext
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchedFileReloadIfChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte("one"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	w := &watchedFile{path: path}
+	var loads atomic.Int32
+	load := func([]byte) error {
+		loads.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+	if err := w.reload(load); err != nil {
+		t.Fatal(err)
+	}
+
+	// The size changes, the modification time does not.
+	modTime := w.modTime
+	if err := os.WriteFile(path, []byte("three"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.reloadIfChanged(load); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := loads.Load(); n != 2 {
+		t.Errorf("file loaded %d times, want 2", n)
+	}
+
+	// Within the check interval, the file is not checked.
+	w.checkInterval = time.Hour
+	if err := os.WriteFile(path, []byte("four!"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.reloadIfChanged(load); err != nil || loads.Load() != 2 {
+		t.Errorf("file loaded within the check interval, error = %v", err)
+	}
+}
@@ -7,11 +7,14 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"log"
 	"net/http"
-	"net/url"
-	"strings"
+	"runtime/debug"
 	"time"
 )
 
+// Resource is the object a request addresses. Requires returns the permission
+// the authenticated subject needs on it to use method. With WithTokenResolver,
+// the subject is the resolved principal rather than the token.
+// Resources that need several permissions also implement Requirer.
 type Resource interface {
 	Requires(principalOrToken string, method string) (ns Namespace, obj Obj, permission Permission)
 }
@@ -26,48 +29,168 @@ type responseWriterWrapper struct {
 	elapsedTime           time.Duration
 	userAgent             string
 	headersSent           bool
+	identity              string
+	requestID             string
+	// route is the path pattern of the route, if known.
+	route string
 }
 
-func Observe(w http.ResponseWriter, r *http.Request, f func(w http.ResponseWriter) error) {
-	clientIP := r.RemoteAddr
-	if colon := strings.LastIndex(clientIP, ":"); colon != -1 {
-		clientIP = clientIP[:colon]
+func (rw *responseWriterWrapper) WriteHeader(status int) {
+	if !rw.headersSent {
+		rw.status = status
+		rw.headersSent = true
 	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriterWrapper) Write(b []byte) (int, error) {
+	rw.headersSent = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.responseBytes += int64(n)
+	return n, err
+}
+
+// Unwrap returns the original ResponseWriter for use with http.ResponseController.
+func (rw *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// setIdentity records the principal of the request for the log lines written by Observe.
+func setIdentity(w http.ResponseWriter, identity string) {
+	if rw, ok := w.(*responseWriterWrapper); ok {
+		rw.identity = identity
+	}
+}
+
+// panicError is a panic recovered by Observe.
+type panicError struct {
+	value any
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// Observe is like ObserveRequest for an f that does not need the request.
+// r is not passed to f and does not carry the request ID of the response, so
+// f must not make Client calls with the context of r; use ObserveRequest then.
+func Observe(w http.ResponseWriter, r *http.Request, f func(w http.ResponseWriter) error, opts ...Option) {
+	ObserveRequest(w, r, func(w http.ResponseWriter, _ *http.Request) error {
+		return f(w)
+	}, opts...)
+}
+
+// ObserveRequest calls f with a ResponseWriter that records the response and
+// with r carrying a request ID, and maps an error returned by f to a problem
+// response. The request ID is echoed on the response, and Client calls made
+// with the context of the request passed to f forward it.
+// A panic in f is recovered, logged with its stack trace and answered with
+// a 500 problem if no headers have been sent yet. Of opts, only WithPanicHook
+// and WithRepanic apply to ObserveRequest.
+func ObserveRequest(w http.ResponseWriter, r *http.Request, f func(w http.ResponseWriter, r *http.Request) error, opts ...Option) {
+	observe(w, r, newOptions(opts), f)
+}
+
+// observe is ObserveRequest configured by o.
+func observe(w http.ResponseWriter, r *http.Request, o *options, f func(w http.ResponseWriter, r *http.Request) error) {
+	r = requestWithID(w, r)
+	requestID, _ := RequestIDFromContext(r.Context())
+	uri := redactQuery(r.RequestURI, credentialParams(o.authenticator), false)
 
 	rw := &responseWriterWrapper{
 		ResponseWriter: w,
-		ip:             clientIP,
+		ip:             clientIP(r),
 		time:           time.Time{},
 		method:         r.Method,
-		uri:            r.RequestURI,
+		uri:            uri,
 		protocol:       r.Proto,
 		status:         http.StatusOK,
 		elapsedTime:    time.Duration(0),
 		userAgent:      r.UserAgent(),
+		identity:       "-",
+		requestID:      requestID,
+		route:          o.routePath,
 	}
 	startTime := time.Now()
-	err := f(rw)
+	err := callRecover(rw, r, f)
 	finishTime := time.Now()
 	rw.time = finishTime.UTC()
 	rw.elapsedTime = finishTime.Sub(startTime)
 
-	if err != nil {
+	var pe *panicError
+	if errors.As(err, &pe) {
+		mapError(err, rw, r)
+		log.Printf("%s %s: error=%s%s\n%s", r.Method, rw.uri, pe.Error(), rw.logFields(), pe.stack)
+	} else if err != nil {
 		errMsg := mapError(err, rw, r)
 		if errMsg != "" {
-			log.Printf("%s %s: error=%s identity=%s duration=%s", r.Method, r.RequestURI, errMsg, "-", rw.elapsedTime.String())
+			log.Printf("%s %s: error=%s%s", r.Method, rw.uri, errMsg, rw.logFields())
+		}
+	}
+
+	if pe != nil {
+		if o.panicHook != nil {
+			o.panicHook(r, pe.value, pe.stack)
+		}
+		if o.repanic {
+			panic(pe.value)
 		}
 	}
 }
 
+// logFields returns the fields of an error log line that follow the error.
+func (rw *responseWriterWrapper) logFields() string {
+	fields := fmt.Sprintf(" identity=%s request_id=%s duration=%s", rw.identity, rw.requestID, rw.elapsedTime.String())
+	if rw.route != "" {
+		fields = " route=" + rw.route + fields
+	}
+	return fields
+}
+
+// callRecover calls f and turns a panic into a *panicError.
+// http.ErrAbortHandler is passed on to net/http unchanged.
+func callRecover(w http.ResponseWriter, r *http.Request, f func(w http.ResponseWriter, r *http.Request) error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			err = &panicError{value: v, stack: debug.Stack()}
+		}
+	}()
+	return f(w, r)
+}
+
 func mapError(err error, w *responseWriterWrapper, req *http.Request) (errMsg string) {
+	if w.headersSent {
+		// Too late to change the response, the error can only be logged.
+		return fmt.Sprintf("%v", err)
+	}
 
 	var problem problemer
 	if errors.As(err, &problem) {
-		http.Error(w, fmt.Sprintf("%s: %s", problem.Error(), problem.Detail()), problem.Status())
-		return ""
+		doc := problemDocument{
+			Title:     problem.Error(),
+			Status:    problem.Status(),
+			Detail:    problem.Detail(),
+			RequestID: w.requestID,
+		}
+		if p, ok := problem.(*Problem); ok {
+			doc.Title = http.StatusText(p.status)
+			doc.InvalidParams = p.invalidParams
+			if p.retryAfter > 0 {
+				w.Header().Set("Retry-After", retryAfterSeconds(p.retryAfter))
+			}
+			if p.cause != nil {
+				errMsg = fmt.Sprintf("%v", err)
+			}
+		}
+		writeProblem(w, doc)
+		return errMsg
 	}
 
-	http.Error(w, "", http.StatusInternalServerError)
+	writeProblem(w, problemDocument{Status: http.StatusInternalServerError, RequestID: w.requestID})
 	errMsg = fmt.Sprintf("%v", err)
 	return errMsg
 }
@@ -76,8 +199,8 @@ func mapError(err error, w *responseWriterWrapper, req *http.Request) (errMsg st
 //   - passes a Resource to the handler that can be used to access the extracted parameters
 //   - passes a User to the handler that can be used to access the authenticated user
 //     and perform further authorize checks
-//   - allows the handler to return an error. This error can implement the problemer interface
-//     to control how error response is constructured.
+//   - allows the handler to return an error. A *Problem, or any error implementing the
+//     problemer interface, controls how the error response is constructed.
 type HandlerFunc func(http.ResponseWriter, *http.Request, httprouter.Params, Resource, User) error
 
 type Meter interface {
@@ -92,127 +215,223 @@ type Wrapper interface {
 // TODO const None = Permission("none")
 const Impossible = Permission("impossible")
 
-func Wrap(wrapper Wrapper, extract func(r *http.Request, p httprouter.Params) (Resource, error), hdl HandlerFunc) httprouter.Handle {
-	return httprouter.Handle(func(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+// ExtractFunc extracts the Resource a request addresses from the request and its route parameters.
+type ExtractFunc func(r *http.Request, p httprouter.Params) (Resource, error)
 
-		sessionCookie, err := r.Cookie("session")
-		if errors.Is(err, http.ErrNoCookie) {
-			back := url.QueryEscape(r.RequestURI)
-			uri := fmt.Sprintf("/signin?back=%s", back)
-			http.Redirect(rw, r, uri, http.StatusSeeOther)
-			return
-		}
+// Wrap returns a handle that authenticates the request by its session cookie,
+// checks the permission the extracted resource requires and calls hdl.
+// Requests without a session cookie are answered according to DefaultSignIn.
+func Wrap(wrapper Wrapper, extract ExtractFunc, hdl HandlerFunc) httprouter.Handle {
+	return WrapWith(wrapper, extract, hdl)
+}
+
+// WrapAuthenticated is like Wrap but authenticates the request with auth.
+func WrapAuthenticated(auth Authenticator, wrapper Wrapper, extract ExtractFunc, hdl HandlerFunc) httprouter.Handle {
+	return WrapWith(wrapper, extract, hdl, WithAuthenticator(auth))
+}
 
-		checkFunc := wrapper.Check
+// WrapWith is like Wrap but configured by opts.
+func WrapWith(wrapper Wrapper, extract ExtractFunc, hdl HandlerFunc, opts ...Option) httprouter.Handle {
+	o := newOptions(opts)
+	auth := o.authenticator
+	if wrapper == nil && !o.authenticateOnly {
+		panic("WrapWith requires a Wrapper")
+	}
+	if o.registry != nil {
+		o.registry.add(newRoute(o.routeMethod, o.routePath, extract, o))
+	}
 
-		// If we have a check-timestamp hint, overwrite the checkfunc
-		checkTimestampCookie, err := r.Cookie("check_ts")
-		if err == nil {
-			checkTimestamp := Timestamp(checkTimestampCookie.Value)
-			if checkTimestampCookie.Value == "" {
-				checkTimestamp = TimestampEpoch()
+	return httprouter.Handle(func(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		observe(rw, r, o, func(w http.ResponseWriter, r *http.Request) error {
+			subject, err := auth.Authenticate(r)
+			if o.observeAuth != nil {
+				o.observeAuth(r, subject, err)
 			}
-			log.Printf("Check timestamp: %s", checkTimestamp)
-			checkFunc = func(ctx context.Context, ns Namespace, obj Obj, permission Permission, userId UserId) (principal Principal, ok bool, err error) {
-				return wrapper.CheckWithTimestamp(ctx, ns, obj, permission, userId, checkTimestamp)
+			if err != nil {
+				return unauthenticated(w, r, auth, o, err)
 			}
-		}
-
-		token := sessionCookie.Value
+			if o.tokenResolver != nil && subject.Token != "" {
+				principal, err := o.tokenResolver.ResolveToken(r.Context(), subject.Token)
+				if errors.Is(err, ErrUnknownToken) {
+					return unauthenticated(w, r, auth, o, fmt.Errorf("%w: %w", ErrInvalidCredentials, err))
+				}
+				if err != nil {
+					return fmt.Errorf("resolve token: %w", err)
+				}
+				subject.UserId = UserId(principal)
+			}
+			// Errors and panics from here on are logged with the subject,
+			// which the principal of the grant replaces after the check.
+			setIdentity(w, string(subject.UserId))
 
-		Observe(rw, r, func(w http.ResponseWriter) error {
 			resource, err := extract(r, p)
 			if err != nil {
 				return fmt.Errorf("extract: %w", err)
 			}
-			ns, obj, permission := resource.Requires(token, r.Method)
-			fmt.Printf("Access - %s,%s,%s\n", ns, obj, permission)
-
-			principal, ok, err := checkFunc(r.Context(), ns, obj, permission, UserId(token))
-			if err != nil {
-				return fmt.Errorf("check: %w", err)
+			ns, obj, permission := resource.Requires(string(subject.UserId), r.Method)
+			requirement := Require(ns, obj, permission)
+			if requirer, ok := resource.(Requirer); ok {
+				requirement = requirer.Requirement(string(subject.UserId), r.Method)
 			}
-			if !ok {
-				w.WriteHeader(http.StatusForbidden)
-				return nil
+			requestID, _ := RequestIDFromContext(r.Context())
+			if wrapper == nil {
+				log.Printf("Access - authenticated request_id=%s", requestID)
+			} else {
+				log.Printf("Access - %s request_id=%s", requirement, requestID)
 			}
 
 			user := user{
 				ns:        ns,
 				obj:       obj,
-				principal: principal,
+				principal: Principal(subject.UserId),
+				subject:   Principal(subject.UserId),
+				token:     subject.Token,
 				ctx:       r.Context(),
-				check:     checkFunc,
-				list:      wrapper.List,
 			}
 
-			return hdl(w, r, p, resource, &user)
-		})
-	})
-}
-
-//func validateCookieValueAndSetTimestamp(timestampCookieVal string, nowUtcMillis string) Timestamp {
-//	parts := strings.SplitN(timestampCookieVal, ":", 2)
-//	if len(parts) == 2 {
-//		return Timestamp(parts[1])
-//	} else {
-//		return Timestamp(nowUtcMillis)
-//	}
-//}
-
-type BasicWrapper interface {
-	Authenticate(ctx context.Context, username, password []byte) (bool, error)
-}
+			if wrapper == nil {
+				// Authentication only, see BasicAuthenticateOnly. The user reports
+				// ErrNoChecker for all checks.
+				if chain, ok := resource.(*ResourceChain); ok {
+					if err := chain.verify(r.Context()); err != nil {
+						return err
+					}
+				}
+				return hdl(w, r, p, resource, &user)
+			}
 
-func BasicWrap(wrapper BasicWrapper, extract func(r *http.Request, p httprouter.Params) (Resource, error), hdl HandlerFunc) httprouter.Handle {
-	return httprouter.Handle(func(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+			checkFunc := checkFn(wrapper.Check)
 
-		username, password, ok := r.BasicAuth()
-		if !ok {
-			rw.Header().Set("WWW-Authenticate", `Basic realm="TODO"`)
-			rw.WriteHeader(http.StatusUnauthorized)
-			return
-		}
+			// If we have a verified check-timestamp hint, overwrite the checkfunc.
+			// Subjects without a token have no session the cookie could be bound to.
+			if o.timestampCookie != nil && subject.Token != "" {
+				if checkTimestamp, ok := o.timestampCookie.timestamp(w, r, subject.Token); ok {
+					checkFunc = func(ctx context.Context, ns Namespace, obj Obj, permission Permission, userId UserId) (principal Principal, ok bool, err error) {
+						return wrapper.CheckWithTimestamp(ctx, ns, obj, permission, userId, checkTimestamp)
+					}
+				}
+			}
+			if o.checkTimeout > 0 {
+				checkFunc = withTimeout(checkFunc, o.checkTimeout)
+			}
+			listFunc := listFn(wrapper.List)
+			if len(subject.Scopes) > 0 {
+				checkFunc, listFunc = withScopes(checkFunc, listFunc, subject.Scopes)
+			}
 
-		Observe(rw, r, func(w http.ResponseWriter) error {
-			ok, err := wrapper.Authenticate(r.Context(), []byte(username), []byte(password))
+			grants, ok, err := requirement.evaluate(r.Context(), checkFunc, subject.UserId)
 			if err != nil {
-				return fmt.Errorf("authenticate basic: %w", err)
+				return fmt.Errorf("check: %w", err)
+			}
+			if len(grants) > 0 && grants[0].Principal != "" {
+				setIdentity(w, string(grants[0].Principal))
 			}
-
 			if !ok {
-				rw.Header().Set("WWW-Authenticate", `Basic realm="TODO"`)
-				rw.WriteHeader(http.StatusUnauthorized)
-				return nil
+				return NewProblem(http.StatusForbidden, "permission denied")
 			}
-
-			resource, err := extract(r, p)
-			if err != nil {
-				return fmt.Errorf("extract: %w", err)
+			if chain, ok := resource.(*ResourceChain); ok {
+				if err := chain.verify(r.Context()); err != nil {
+					return err
+				}
 			}
-			ns, obj, permission := resource.Requires(username, r.Method)
-			_ = permission
-
-			// TODO
-			//principal, ok, err := checkFunc(r.Context(), ns, obj, permission, UserId(token))
-			//if err != nil {
-			//	return fmt.Errorf("check: %w", err)
-			//}
-			//if !ok {
-			//	w.WriteHeader(http.StatusForbidden)
-			//	return nil
-			//}
 
-			user := user{
-				ns:        ns,
-				obj:       obj,
-				principal: Principal(username), // TODOprincipal,
-				ctx:       r.Context(),
-				check:     nil, //checkFunc,
-				list:      nil, //wrapper.List,
+			if len(grants) > 0 {
+				user.principal = grants[0].Principal
 			}
+			user.grants = grants
+			user.check = checkFunc
+			user.list = listFunc
 
 			return hdl(w, r, p, resource, &user)
 		})
 	})
 }
+
+// checkFn is the signature of Wrapper.Check.
+type checkFn func(ctx context.Context, ns Namespace, obj Obj, permission Permission, userId UserId) (principal Principal, ok bool, err error)
+
+// listFn is the signature of Wrapper.List.
+type listFn func(ctx context.Context, ns Namespace, permission Permission, userId UserId) ([]string, error)
+
+// withScopes denies all permissions outside of scopes without asking the check service.
+func withScopes(check checkFn, list listFn, scopes []Permission) (checkFn, listFn) {
+	scopedCheck := func(ctx context.Context, ns Namespace, obj Obj, permission Permission, userId UserId) (principal Principal, ok bool, err error) {
+		if !inScope(scopes, permission) {
+			return "", false, nil
+		}
+		return check(ctx, ns, obj, permission, userId)
+	}
+	scopedList := func(ctx context.Context, ns Namespace, permission Permission, userId UserId) ([]string, error) {
+		if !inScope(scopes, permission) {
+			return nil, nil
+		}
+		return list(ctx, ns, permission, userId)
+	}
+	return scopedCheck, scopedList
+}
+
+// withTimeout limits the duration of every call of check to d.
+func withTimeout(check checkFn, d time.Duration) checkFn {
+	return func(ctx context.Context, ns Namespace, obj Obj, permission Permission, userId UserId) (principal Principal, ok bool, err error) {
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		return check(ctx, ns, obj, permission, userId)
+	}
+}
+
+// unauthenticated answers a request that auth did not authenticate.
+// Authenticators with challenges get a 401 response, all others are handled
+// by the SignIn of o.
+// Errors other than ErrNoCredentials and ErrInvalidCredentials are returned as is.
+func unauthenticated(w http.ResponseWriter, r *http.Request, auth Authenticator, o *options, err error) error {
+	if !errors.Is(err, ErrNoCredentials) && !errors.Is(err, ErrInvalidCredentials) {
+		return fmt.Errorf("authenticate: %w", err)
+	}
+	challenges := challengesOf(auth)
+	if len(challenges) == 0 {
+		if params := credentialParams(auth); len(params) > 0 {
+			// Keep credentials out of the sign-in redirect.
+			r = r.WithContext(r.Context())
+			r.RequestURI = redactQuery(r.RequestURI, params, true)
+		}
+		return o.signIn.unauthenticated(w, r, err)
+	}
+	for _, challenge := range challenges {
+		w.Header().Add("WWW-Authenticate", challenge)
+	}
+	if o.unauthorized != nil {
+		return o.unauthorized(w, r, err)
+	}
+	return unauthorizedProblem(err)
+}
+
+type BasicWrapper interface {
+	Authenticate(ctx context.Context, username, password []byte) (bool, error)
+}
+
+// BasicWrap returns a handle that authenticates the request with HTTP basic
+// authentication, checks the permission the extracted resource requires for the
+// username with checker and calls hdl. BasicWrap panics if checker is nil; routes
+// that only authenticate use BasicAuthenticateOnly.
+//
+// To configure the authenticator, e.g. its realm, pass a BasicAuthenticator to
+// WrapWith with WithAuthenticator instead.
+func BasicWrap(wrapper BasicWrapper, checker Wrapper, extract ExtractFunc, hdl HandlerFunc, opts ...Option) httprouter.Handle {
+	if checker == nil {
+		panic("BasicWrap requires a checker, use BasicAuthenticateOnly for routes without permission check")
+	}
+	return WrapWith(checker, extract, hdl, basicOptions(wrapper, opts)...)
+}
+
+// BasicAuthenticateOnly returns a handle that authenticates the request with
+// HTTP basic authentication and calls hdl without checking any permission.
+// The permission the resource requires is ignored, and the permission checks
+// of the User return ErrNoChecker.
+func BasicAuthenticateOnly(wrapper BasicWrapper, extract ExtractFunc, hdl HandlerFunc, opts ...Option) httprouter.Handle {
+	return WrapWith(nil, extract, hdl, append(basicOptions(wrapper, opts), withAuthenticateOnly())...)
+}
+
+// basicOptions returns opts with a basic authenticator for wrapper.
+func basicOptions(wrapper BasicWrapper, opts []Option) []Option {
+	return append(opts[:len(opts):len(opts)], WithAuthenticator(NewBasicAuthenticator(wrapper)))
+}
@@ -0,0 +1,246 @@
+package httprouterext
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// testWrapper grants the permissions of granted and records the checks.
+type testWrapper struct {
+	mu         sync.Mutex
+	granted    map[Permission]bool
+	errs       map[Permission]error
+	checks     []Permission
+	timestamps []Timestamp
+}
+
+func (c *testWrapper) Check(ctx context.Context, ns Namespace, obj Obj, permission Permission, userId UserId) (Principal, bool, error) {
+	return c.CheckWithTimestamp(ctx, ns, obj, permission, userId, "")
+}
+
+func (c *testWrapper) CheckWithTimestamp(_ context.Context, _ Namespace, _ Obj, permission Permission, userId UserId, ts Timestamp) (Principal, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, permission)
+	c.timestamps = append(c.timestamps, ts)
+	if err := c.errs[permission]; err != nil {
+		return "", false, err
+	}
+	return Principal(userId), c.granted[permission], nil
+}
+
+func (c *testWrapper) List(context.Context, Namespace, Permission, UserId) ([]string, error) {
+	return nil, nil
+}
+
+// testResource requires permission on obj in ns, or requirement if it is set.
+type testResource struct {
+	ns          Namespace
+	obj         Obj
+	permission  Permission
+	requirement Requirement
+}
+
+func (r *testResource) Requires(string, string) (Namespace, Obj, Permission) {
+	return r.ns, r.obj, r.permission
+}
+
+func (r *testResource) Requirement(string, string) Requirement {
+	if r.requirement != nil {
+		return r.requirement
+	}
+	return Require(r.ns, r.obj, r.permission)
+}
+
+// extractResource returns an ExtractFunc that always extracts resource.
+func extractResource(resource Resource) ExtractFunc {
+	return func(*http.Request, httprouter.Params) (Resource, error) {
+		return resource, nil
+	}
+}
+
+// okHandler answers 200.
+func okHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params, _ Resource, _ User) error {
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// testBasicWrapper accepts the password "secret" for every username.
+type testBasicWrapper struct{}
+
+func (testBasicWrapper) Authenticate(_ context.Context, _, password []byte) (bool, error) {
+	return string(password) == "secret", nil
+}
+
+func TestBasicWrap(t *testing.T) {
+	wrapper := &testWrapper{granted: map[Permission]bool{"article.get": true}}
+	tests := []struct {
+		name       string
+		resource   *testResource
+		password   string
+		wantStatus int
+	}{
+		{name: "granted", resource: &testResource{ns: "article", obj: "1", permission: "article.get"}, password: "secret", wantStatus: http.StatusOK},
+		{name: "denied", resource: &testResource{ns: "article", obj: "1", permission: "article.delete"}, password: "secret", wantStatus: http.StatusForbidden},
+		{name: "impossible", resource: &testResource{ns: "a", obj: "b", permission: Impossible}, password: "secret", wantStatus: http.StatusForbidden},
+		{name: "wrong password", resource: &testResource{ns: "article", obj: "1", permission: "article.get"}, password: "wrong", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hdl := BasicWrap(testBasicWrapper{}, wrapper, extractResource(tt.resource), okHandler)
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.SetBasicAuth("alice", tt.password)
+			w := httptest.NewRecorder()
+			hdl(w, r, nil)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestBasicWrapRequiresChecker(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("BasicWrap with a nil checker did not panic")
+		}
+	}()
+	BasicWrap(testBasicWrapper{}, nil, extractResource(&testResource{permission: Impossible}), okHandler)
+}
+
+func TestBasicAuthenticateOnly(t *testing.T) {
+	var checkErr error
+	hdl := BasicAuthenticateOnly(testBasicWrapper{}, extractResource(&testResource{ns: "a", obj: "b", permission: Impossible}),
+		func(w http.ResponseWriter, r *http.Request, _ httprouter.Params, _ Resource, u User) error {
+			_, checkErr = u.Can(r.Context(), "article.get")
+			w.WriteHeader(http.StatusOK)
+			return nil
+		})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.SetBasicAuth("alice", "secret")
+	w := httptest.NewRecorder()
+	hdl(w, r, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if !errors.Is(checkErr, ErrNoChecker) {
+		t.Errorf("Can() error = %v, want ErrNoChecker", checkErr)
+	}
+}
+
+func TestWrapRecoversPanics(t *testing.T) {
+	panicking := func(*http.Request, httprouter.Params) (Resource, error) {
+		panic("article store not initialized")
+	}
+	tests := []struct {
+		name       string
+		extract    ExtractFunc
+		hdl        HandlerFunc
+		wantStatus int
+		wantBody   bool
+	}{
+		{name: "extract", extract: panicking, hdl: okHandler, wantStatus: http.StatusInternalServerError, wantBody: true},
+		{name: "handler", extract: extractResource(&testResource{ns: "article", obj: "1", permission: "article.get"}), hdl: func(http.ResponseWriter, *http.Request, httprouter.Params, Resource, User) error {
+			panic("article store not initialized")
+		}, wantStatus: http.StatusInternalServerError, wantBody: true},
+		// Too late for a problem, the response keeps its status.
+		{name: "after headers", extract: extractResource(&testResource{ns: "article", obj: "1", permission: "article.get"}), hdl: func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params, _ Resource, _ User) error {
+			w.WriteHeader(http.StatusAccepted)
+			panic("article store not initialized")
+		}, wantStatus: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			defer log.SetOutput(log.Writer())
+			log.SetOutput(&logs)
+
+			var hooked *http.Request
+			var hookedValue any
+			var hookedStack []byte
+			router := NewRouter(&testWrapper{granted: map[Permission]bool{"article.get": true}},
+				WithAuthenticator(NewHeaderAuthenticator("X-User")),
+				WithPanicHook(func(r *http.Request, recovered any, stack []byte) {
+					hooked, hookedValue, hookedStack = r, recovered, stack
+				}))
+			router.GET("/articles/:id", tt.extract, tt.hdl, WithTemplate(&testResource{ns: "article", obj: ":id", permission: "article.get"}))
+
+			r := httptest.NewRequest(http.MethodGet, "/articles/1?page=2", nil)
+			r.Header.Set("X-User", "alice")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Body.Len() > 0; got != tt.wantBody {
+				t.Errorf("body = %q", w.Body.String())
+			}
+			_, line, _ := strings.Cut(logs.String(), "GET /articles/1")
+			line, _, _ = strings.Cut("GET /articles/1"+line, "\n")
+			for _, want := range []string{"GET /articles/1?page=2: error=panic: article store not initialized", "route=/articles/:id", "identity=alice", "request_id="} {
+				if !strings.Contains(line, want) {
+					t.Errorf("log line %q lacks %q", line, want)
+				}
+			}
+			if !strings.Contains(logs.String(), "goroutine") {
+				t.Errorf("log lacks the stack trace:\n%s", logs.String())
+			}
+			if hooked == nil || hookedValue != "article store not initialized" || len(hookedStack) == 0 {
+				t.Fatalf("panic hook got %v, %v, %d bytes of stack", hooked, hookedValue, len(hookedStack))
+			}
+			if _, ok := RequestIDFromContext(hooked.Context()); !ok {
+				t.Error("panic hook request lacks the request ID")
+			}
+		})
+	}
+}
+
+func TestWrapRepanic(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	hdl := WrapWith(&testWrapper{granted: map[Permission]bool{"article.get": true}}, extractResource(&testResource{ns: "article", obj: "1", permission: "article.get"}), func(http.ResponseWriter, *http.Request, httprouter.Params, Resource, User) error {
+		panic("boom")
+	}, WithAuthenticator(NewHeaderAuthenticator("X-User")), WithRepanic())
+	r := httptest.NewRequest(http.MethodGet, "/articles/1", nil)
+	r.Header.Set("X-User", "alice")
+	w := httptest.NewRecorder()
+
+	func() {
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Errorf("recovered %v, want the original panic", v)
+			}
+		}()
+		hdl(w, r, nil)
+	}()
+	// The problem is written before the panic is passed on.
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestWrapPassesAbortHandler(t *testing.T) {
+	hdl := WrapWith(&testWrapper{granted: map[Permission]bool{"article.get": true}}, extractResource(&testResource{ns: "article", obj: "1", permission: "article.get"}), func(http.ResponseWriter, *http.Request, httprouter.Params, Resource, User) error {
+		panic(http.ErrAbortHandler)
+	}, WithAuthenticator(NewHeaderAuthenticator("X-User")))
+	r := httptest.NewRequest(http.MethodGet, "/articles/1", nil)
+	r.Header.Set("X-User", "alice")
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", v)
+		}
+	}()
+	hdl(httptest.NewRecorder(), r, nil)
+}